@@ -15,7 +15,9 @@ func showHelp() {
 		cmdStartHelpInfo(),
 		cmdAddProcHelpInfo(),
 		cmdReloadHelpInfo(),
+		cmdUpgradeHelpInfo(),
 		cmdShutdownHelpInfo(),
+		cmdPurgeHelpInfo(),
 		cmdServiceHelpInfo(),
 		cmdExecHelpInfo(),
 		cmdHelpHelpInfo(),
@@ -88,6 +90,14 @@ func cmdReloadHelpInfo() string {
 	return helpBuf.String()
 }
 
+func cmdUpgradeHelpInfo() string {
+	helpBuf := new(strings.Builder)
+	fmt.Fprintf(helpBuf, "supervisord %s [new-binary]\n", color.Yellow(`upgrade`))
+	helpBuf.WriteString(space(4) + "replace running supervisord by new binary without restarting process, needs keep_children\n")
+	helpBuf.WriteString(space(4) + "new binary is installed in place of current one after it passes self check, default current binary\n")
+	return helpBuf.String()
+}
+
 func cmdExecHelpInfo() string {
 	helpBuf := new(strings.Builder)
 	fmt.Fprintf(helpBuf, "supervisord %s\n", color.Yellow(`exec`))
@@ -100,10 +110,19 @@ func cmdShutdownHelpInfo() string {
 	fmt.Fprintf(helpBuf, "supervisord %s\n", color.Red(`shutdown`))
 	fmt.Fprintf(helpBuf, space(4)+"--clear clear log files\n")
 	fmt.Fprintf(helpBuf, space(4)+"--now shutdown immediately\n")
+	fmt.Fprintf(helpBuf, space(4)+"--dry-run with --clear only print files running supervisord would remove, it keeps running\n")
 	helpBuf.WriteString(space(4) + color.Red(`[DANGER]`) + " stop all process by send signal TERM, then exit supervisord\n")
 	return helpBuf.String()
 }
 
+func cmdPurgeHelpInfo() string {
+	helpBuf := new(strings.Builder)
+	fmt.Fprintf(helpBuf, "supervisord %s\n", color.Red(`purge`))
+	fmt.Fprintf(helpBuf, space(4)+"--dry-run only print files would be removed, asked from supervisord if it is running\n")
+	helpBuf.WriteString(space(4) + color.Red(`[DANGER]`) + " remove log files and purge_files of stopped supervisord\n")
+	return helpBuf.String()
+}
+
 func cmdServiceHelpInfo() string {
 	helpBuf := new(strings.Builder)
 	fmt.Fprintf(helpBuf, "supervisord %s %s\n", color.Yellow(`service`), color.Green(`start`))
@@ -115,12 +134,36 @@ func cmdServiceHelpInfo() string {
 	fmt.Fprintf(helpBuf, "supervisord %s %s\n", color.Yellow(`service`), color.Green(`restart`))
 	helpBuf.WriteString(space(4) + "restart process\n")
 
+	fmt.Fprintf(helpBuf, "supervisord %s %s --rolling [--batch N] [--wait-healthy 30s] group:NAME|all\n", color.Yellow(`service`), color.Green(`restart`))
+	helpBuf.WriteString(space(4) + "restart processes batch by batch, abort if a batch is not healthy\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s NAME\n", color.Yellow(`service`), color.Green(`run-now`))
+	helpBuf.WriteString(space(4) + "run scheduled or oneshot process immediately\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s NAME\n", color.Yellow(`service`), color.Green(`pause`))
+	helpBuf.WriteString(space(4) + "freeze process group by SIGSTOP\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s NAME\n", color.Yellow(`service`), color.Green(`resume`))
+	helpBuf.WriteString(space(4) + "continue paused process group by SIGCONT\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s SIGNAME NAME|all|group:G [--leader]\n", color.Yellow(`service`), color.Green(`signal`))
+	helpBuf.WriteString(space(4) + "send signal to process group, --leader only signals the process itself\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s NAME\n", color.Yellow(`service`), color.Green(`reload-proc`))
+	helpBuf.WriteString(space(4) + "send reload_signal to process and check it is still healthy\n")
+
 	fmt.Fprintf(helpBuf, "supervisord %s %s\n", color.Yellow(`service`), color.Green(`status`))
 	helpBuf.WriteString(space(4) + "display process status\n")
 
 	fmt.Fprintf(helpBuf, "supervisord %s %s\n", color.Yellow(`service`), color.Green(`env`))
 	helpBuf.WriteString(space(4) + "display process env\n")
 
+	fmt.Fprintf(helpBuf, "supervisord %s %s [NAME...] [--type EXITED,FATAL]\n", color.Yellow(`service`), color.Green(`events`))
+	helpBuf.WriteString(space(4) + "print process events stream\n")
+
+	fmt.Fprintf(helpBuf, "supervisord %s %s\n", color.Yellow(`service`), color.Green(`log-usage`))
+	helpBuf.WriteString(space(4) + "display disk usage of log files\n")
+
 	return helpBuf.String()
 }
 
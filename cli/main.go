@@ -8,11 +8,17 @@ import (
 	"github.com/qjpcpu/supervisord/daemon"
 	"github.com/qjpcpu/supervisord/sys"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/qjpcpu/supervisord/config"
 )
 
+/* exit code of supervisord run by start, see daemon.Supervisord.ExitCode */
+var daemonExitCode int
+
 func Run() {
 	args := sys.Args()
 	if len(args) < 2 {
@@ -29,6 +35,10 @@ func Run() {
 		err = addProc(getArgsFrom(2, args))
 	case `reload`:
 		err = reloadDaemon()
+	case `upgrade`:
+		err = upgradeDaemon(getArgsFrom(2, args))
+	case `selfcheck`:
+		err = selfCheck(getArgsFrom(2, args))
 	case `exec`:
 		vargs := getArgsFrom(2, args)
 		if len(vargs) != 1 {
@@ -38,18 +48,31 @@ func Run() {
 		err = execCommand(vargs[0])
 	case `shutdown`:
 		option := daemon.StopOption{}
+		var dryRun bool
 		for _, elem := range getArgsFrom(2, args) {
 			switch elem {
 			case "-clear", "--clear":
 				option.ClearLog = true
 			case "-now", "--now":
 				option.StopImmediately = true
+			case "-dry-run", "--dry-run":
+				dryRun = true
 			case "-h", "--help":
 				fmt.Println(cmdShutdownHelpInfo())
 				return
 			}
 		}
+		if dryRun {
+			if !option.ClearLog {
+				err = errors.New("--dry-run works with --clear only")
+			} else {
+				err = ctl.PurgeDryRun(context.Background())
+			}
+			break
+		}
 		err = ctl.Shutdown(context.Background(), option)
+	case `purge`:
+		err = purgeLogs(getArgsFrom(2, args))
 	case `help`, `-h`, `--help`, `-help`, `h`:
 		showHelp()
 	default:
@@ -60,11 +83,18 @@ func Run() {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	if daemonExitCode != 0 {
+		os.Exit(daemonExitCode)
+	}
 }
 
 func startDaemon(args []string) error {
-	if err := ctl.Status(context.Background()); err == nil {
-		return errors.New("supervisord is already running")
+	/* exec'ed by upgrade, the admin listener is handed over and not served yet */
+	upgrade := daemon.IsUpgrade()
+	if !upgrade {
+		if err := ctl.Status(context.Background()); err == nil {
+			return errors.New("supervisord is already running")
+		}
 	}
 
 	// Before starting as a new daemon, the program first acts as a "client"
@@ -90,15 +120,20 @@ func startDaemon(args []string) error {
 		prov.UpdateConfig(cnf)
 	}
 	cnf := prov.GetConfig()
-	if cnf.Daemonize {
+	if cnf.Daemonize && !upgrade {
 		Daemonize(func() {
 			defer prov.Close()
 			daemon.Get().Start()
+			daemonExitCode = daemon.Get().ExitCode()
 		})
 		return nil
 	}
 	defer prov.Close()
-	return daemon.Get().Start()
+	if err := daemon.Get().Start(); err != nil {
+		return err
+	}
+	daemonExitCode = daemon.Get().ExitCode()
+	return nil
 }
 
 func addProc(args []string) error {
@@ -118,10 +153,65 @@ func addProc(args []string) error {
 	return ctl.AddProc(context.Background(), cnf)
 }
 
+func purgeLogs(args []string) error {
+	var dryRun bool
+	for _, elem := range args {
+		switch elem {
+		case "-dry-run", "--dry-run":
+			dryRun = true
+		case "-h", "--help":
+			fmt.Println(cmdPurgeHelpInfo())
+			return nil
+		}
+	}
+	if ctl.IsRunning() {
+		if !dryRun {
+			return errors.New("supervisord is running, use shutdown --clear instead")
+		}
+		/* running supervisord knows files of its runtime config */
+		return ctl.PurgeDryRun(context.Background())
+	}
+	return daemon.PurgeLogs(dryRun, os.Stdout)
+}
+
 func reloadDaemon() error {
 	return ctl.Reload(context.Background())
 }
 
+func upgradeDaemon(args []string) error {
+	var binary string
+	for _, elem := range args {
+		switch elem {
+		case "-h", "--help":
+			fmt.Println(cmdUpgradeHelpInfo())
+			return nil
+		default:
+			binary = elem
+		}
+	}
+	if binary != "" {
+		abs, err := filepath.Abs(binary)
+		if err != nil {
+			return err
+		}
+		binary = abs
+	}
+	return ctl.Upgrade(context.Background(), binary)
+}
+
+// selfCheck is run on new binary by upgrade, it checks binary works with config file
+func selfCheck(args []string) error {
+	if len(args) > 0 {
+		if _, err := config.LoadConfigFile(args[0]); err != nil {
+			return err
+		}
+	} else if err := config.Provider().CheckConfigFile(); err != nil {
+		return err
+	}
+	fmt.Println("OK")
+	return nil
+}
+
 func execCommand(file string) error {
 	return ctl.ExecCommand(context.Background(), file)
 }
@@ -145,15 +235,99 @@ func serviceCommand(args []string) error {
 			return ctl.StopAll(ctx)
 		}
 	case `restart`:
-		if len(args) > 1 {
-			return ctl.RestartProcess(ctx, args[1])
+		var rolling bool
+		batch, waitHealthy := 1, 30*time.Second
+		var rest []string
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "-rolling", "--rolling":
+				rolling = true
+			case "-batch", "--batch":
+				if i+1 < len(args) {
+					n, err := strconv.Atoi(args[i+1])
+					if err != nil || n <= 0 {
+						return fmt.Errorf("bad batch size %s", args[i+1])
+					}
+					batch = n
+					i++
+				}
+			case "-wait-healthy", "--wait-healthy":
+				if i+1 < len(args) {
+					d, err := time.ParseDuration(args[i+1])
+					if err != nil {
+						return err
+					}
+					waitHealthy = d
+					i++
+				}
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		if rolling {
+			if len(rest) != 1 {
+				return errors.New(`usage: service restart --rolling [--batch N] [--wait-healthy 30s] group:NAME|all`)
+			}
+			return ctl.RollingRestart(ctx, rest[0], batch, waitHealthy)
+		}
+		if len(rest) > 0 {
+			return ctl.RestartProcess(ctx, rest[0])
 		} else {
 			return ctl.RestartAll(ctx)
 		}
+	case `run-now`:
+		if len(args) < 2 {
+			return errors.New(`no process name found`)
+		}
+		return ctl.RunProcessNow(ctx, args[1])
+	case `pause`, `resume`:
+		if len(args) < 2 {
+			return errors.New(`no process name found`)
+		}
+		if args[0] == `pause` {
+			return ctl.PauseProcess(ctx, args[1])
+		}
+		return ctl.ResumeProcess(ctx, args[1])
+	case `signal`:
+		var leaderOnly bool
+		var rest []string
+		for _, elem := range args[1:] {
+			switch elem {
+			case "-leader", "--leader":
+				leaderOnly = true
+			default:
+				rest = append(rest, elem)
+			}
+		}
+		if len(rest) != 2 {
+			return errors.New(`usage: service signal SIGNAME NAME|all|group:G [--leader]`)
+		}
+		return ctl.SignalProcess(ctx, rest[1], rest[0], leaderOnly)
+	case `reload-proc`:
+		if len(args) < 2 {
+			return errors.New(`no process name found`)
+		}
+		return ctl.SignalReloadProcess(ctx, args[1])
 	case `status`:
 		return ctl.Status(ctx)
 	case `env`:
 		return ctl.DumpEnv(ctx)
+	case `log-usage`:
+		return ctl.LogUsage(ctx)
+	case `events`:
+		var names, types []string
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "-type", "--type":
+				if i+1 < len(args) {
+					types = append(types, strings.Split(args[i+1], ",")...)
+					i++
+				}
+			default:
+				names = append(names, args[i])
+			}
+		}
+		return ctl.Events(ctx, names, types)
 	case `omit-exit-code`:
 		if len(args) > 1 {
 			return ctl.OmitProcessExitCode(ctx, args[1])
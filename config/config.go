@@ -7,10 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/qjpcpu/fp"
+	"github.com/qjpcpu/supervisord/signals"
 	"github.com/qjpcpu/supervisord/sys"
 )
 
@@ -21,22 +23,64 @@ const (
 	DefaultSuccessExitCode = 0
 )
 
+/* actions of signal_policy */
+const (
+	SignalStop    = "stop"    /* stop all processes and exit */
+	SignalForward = "forward" /* send the signal to all running processes */
+	SignalReload  = "reload"  /* reload config */
+	SignalIgnore  = "ignore"
+)
+
+var defaultSignalPolicy = map[string]string{
+	"TERM": SignalStop,
+	"INT":  SignalStop,
+	"HUP":  SignalReload,
+	"USR1": SignalForward,
+	"USR2": SignalForward,
+}
+
+// PolicySignals returns names of signals handled by signal_policy
+func PolicySignals() []string {
+	return []string{"TERM", "INT", "HUP", "USR1", "USR2"}
+}
+
 type SupervisorConfigInfo struct {
 	File   string
 	Config *SupervisorConfig
 }
 
 type SupervisorConfig struct {
-	AdminListen            int              `toml:"admin_listen" param:"adminlisten,supervisord admin listen on"`
-	AdminBindIP            string           `toml:"admin_bind_ip" param:"admin_bind_ip,supervisord listen on ip default 0.0.0.0"`
-	AdminSock              string           `toml:"admin_sock" param:"admin_sock,supervisord listen on unix socket"`
-	Log                    string           `toml:"log,omitempty" param:"log,supervisord log file"`
-	Process                []*ProcessConfig `toml:"process" param:"-"`
-	ExitWhenAllProcessDone bool             `toml:"exit_when_all_done" param:"exit_when_all_done,exit when all process finished with success"`
-	Daemonize              bool             `toml:"daemonize" param:"daemonize,daemonize supervisord"`
-	ReapZombie             bool             `toml:"reap_zombie" param:"reap_zombie,reap zombie process"`
-	HideArgs               bool             `toml:"hide_args" param:"hide_args,hide command arguments"`
-	DisableRCE             bool             `toml:"disable_rce" param:"disable_rce,disable rce"`
+	AdminListen            int               `toml:"admin_listen" param:"adminlisten,supervisord admin listen on"`
+	AdminBindIP            string            `toml:"admin_bind_ip" param:"admin_bind_ip,supervisord listen on ip default 0.0.0.0"`
+	AdminSock              string            `toml:"admin_sock" param:"admin_sock,supervisord listen on unix socket"`
+	Log                    string            `toml:"log,omitempty" param:"log,supervisord log file"`
+	Process                []*ProcessConfig  `toml:"process" param:"-"`
+	ExitWhenAllProcessDone bool              `toml:"exit_when_all_done" param:"exit_when_all_done,exit when all process finished with success"`
+	Daemonize              bool              `toml:"daemonize" param:"daemonize,daemonize supervisord"`
+	ReapZombie             bool              `toml:"reap_zombie" param:"reap_zombie,reap zombie process"`
+	HideArgs               bool              `toml:"hide_args" param:"hide_args,hide command arguments"`
+	DisableRCE             bool              `toml:"disable_rce" param:"disable_rce,disable rce"`
+	LogDiskQuota           string            `toml:"log_disk_quota,omitempty" param:"log_disk_quota,max disk usage of all log files, e.g. 10G"`
+	Notify                 []*NotifyConfig   `toml:"notify,omitempty" param:"-"`
+	AutoReload             bool              `toml:"auto_reload,omitempty" param:"auto_reload,reload automatically when supervisord.conf changes"`
+	KeepChildren           bool              `toml:"keep_children,omitempty" param:"keep_children,processes survive supervisord crash and are adopted on next start"`
+	StateFile              string            `toml:"state_file,omitempty" param:"state_file,state of running processes for keep_children, default .supervisord.state next to supervisord.conf"`
+	Subreaper              bool              `toml:"subreaper,omitempty" param:"subreaper,adopt orphaned descendants of processes and stop them with their process"`
+	SignalPolicy           map[string]string `toml:"signal_policy,omitempty" param:"signal_policy,action on signal: stop forward reload or ignore, e.g. TERM=stop,USR1=forward"`
+	ShutdownDeadlineSecs   int               `toml:"shutdown_deadline_secs,omitempty" param:"shutdown_deadline_secs,processes still running this seconds after shutdown starts are killed, default no limit"`
+}
+
+// NotifyConfig is a webhook receiving process events
+type NotifyConfig struct {
+	URL         string            `toml:"url"`
+	Method      string            `toml:"method,omitempty"`
+	Headers     map[string]string `toml:"headers,omitempty"`
+	Events      []string          `toml:"events,omitempty"`
+	Process     []string          `toml:"process,omitempty"`
+	Template    string            `toml:"template,omitempty"`
+	Retries     int               `toml:"retries,omitempty"`
+	QueueSize   int               `toml:"queue_size,omitempty"`
+	TimeoutSecs int               `toml:"timeout_secs,omitempty"`
 }
 
 type AddProcConfig struct {
@@ -53,6 +97,7 @@ type ProcessConfig struct {
 	ExitCodes    []int             `toml:"exit_codes" param:"exitcodes,process exit code, e.g. 0,1,2"`
 	StopSignal   string            `toml:"stop_signal" param:"stopsig,process stop signal, default TERM"` // TERM
 	StopWaitSecs int               `toml:"stop_wait_secs" param:"stop_wait_secs,process terminating wait seconds, default 15s"`
+	StopSequence []string          `toml:"stop_sequence,omitempty" param:"stop_sequence,stop steps e.g. USR2,wait 10s,TERM,wait 20s,KILL; default stop_signal then stop_wait_secs"`
 	Stdout       []string          `toml:"stdout" param:"stdout,process stdout, default /dev/stdout"`
 	Stderr       []string          `toml:"stderr" param:"stderr,process stderr, default /dev/stderr"`
 	PurgeFiles   []string          `toml:"purge_files" param:"purge_files,purge files when supervisord exiting"`
@@ -60,7 +105,52 @@ type ProcessConfig struct {
 	StdLogSize   string            `toml:"std_log_size" param:"std_log_size,keep max log size, default 1G"`
 	SysUser      string            `toml:"user,omitempty" param:"user,process user, default current user"`
 	SysGroup     string            `toml:"group,omitempty" param:"group,process user group, default current user group"`
+	Sockets      []string          `toml:"sockets,omitempty" param:"sockets,listening sockets owned by supervisord passed as fd 3.. with LISTEN_FDS, e.g. tcp://0.0.0.0:8080"`
+	ProcGroup    string            `toml:"proc_group,omitempty" param:"proc_group,process group name, select by group:NAME in service commands"`
 	OmitExitCode bool              `toml:"omit_exit_code,omitempty" param:"omit_exit_code,treat all exit code as success, default false"`
+	LogTimestamp bool              `toml:"log_timestamp,omitempty" param:"log_timestamp,prefix each output line with timestamp"`
+	LogMaxLine   int               `toml:"log_max_line,omitempty" param:"log_max_line,truncate output line longer than this bytes"`
+	LogRateLimit int               `toml:"log_rate_limit,omitempty" param:"log_rate_limit,max output lines per second, exceeded lines are dropped"`
+	LogRedact    []string          `toml:"log_redact,omitempty" param:"log_redact,regexps masked in output lines"`
+	/* python supervisor compatible event listener */
+	EventListener bool     `toml:"event_listener,omitempty" param:"event_listener,process is an event listener speaking on stdin/stdout"`
+	Events        []string `toml:"events,omitempty" param:"events,event listener subscriptions, default PROCESS_STATE"`
+	BufferSize    int      `toml:"buffer_size,omitempty" param:"buffer_size,event listener buffer size, default 10"`
+	/* lifecycle hooks run by /bin/sh with process env, cwd and user */
+	PreStart        string `toml:"pre_start,omitempty" param:"pre_start,command run before start, failure aborts start"`
+	PostStart       string `toml:"post_start,omitempty" param:"post_start,command run after process started"`
+	PreStop         string `toml:"pre_stop,omitempty" param:"pre_stop,command run before stop signal sent"`
+	PostStop        string `toml:"post_stop,omitempty" param:"post_stop,command run after process stopped"`
+	HookTimeoutSecs int    `toml:"hook_timeout_secs,omitempty" param:"hook_timeout_secs,hook command timeout seconds, default 30"`
+	/* reload in place and health probe: tcp://host:port, unix:///path, http(s)://url or exec:command */
+	ReloadSignal           string `toml:"reload_signal,omitempty" param:"reload_signal,signal which makes process reload config in place, e.g. HUP"`
+	HealthCheck            string `toml:"health_check,omitempty" param:"health_check,health probe, e.g. tcp://127.0.0.1:8080, http://127.0.0.1:8080/ping, exec:./check.sh"`
+	HealthCheckTimeoutSecs int    `toml:"health_check_timeout_secs,omitempty" param:"health_check_timeout_secs,seconds to wait process healthy, default 10"`
+	/* conditions checked before start: tcp://host:port, unix:///path, file:///path, http(s)://url or exec:command */
+	WaitFor            []string `toml:"wait_for,omitempty" param:"wait_for,conditions to wait before start, e.g. tcp://127.0.0.1:5432,file:///run/db.ready"`
+	WaitForTimeoutSecs int      `toml:"wait_for_timeout_secs,omitempty" param:"wait_for_timeout_secs,seconds to wait each condition, default 60"`
+	/* autostart on supervisord start and reload */
+	Autostart  *bool `toml:"autostart,omitempty" param:"autostart,start process when supervisord starts or reloads, default true"`
+	StartDelay int   `toml:"start_delay,omitempty" param:"start_delay,seconds to delay autostart"`
+	/* cron scheduled and oneshot jobs are never restarted */
+	Schedule      string `toml:"schedule,omitempty" param:"schedule,cron expression, e.g. */5 * * * *"`
+	Type          string `toml:"type,omitempty" param:"type,process type, oneshot runs once without restart"`
+	OverlapPolicy string `toml:"overlap_policy,omitempty" param:"overlap_policy,skip/queue/kill previous run when next run is due, default skip"`
+	/* sd_notify protocol on NOTIFY_SOCKET */
+	Notify            bool `toml:"notify,omitempty" param:"notify,process is starting until it sends READY=1 to NOTIFY_SOCKET"`
+	NotifyTimeoutSecs int  `toml:"notify_timeout_secs,omitempty" param:"notify_timeout_secs,seconds to wait READY=1 before killing process, default 90"`
+	WatchdogSecs      int  `toml:"watchdog_secs,omitempty" param:"watchdog_secs,restart process if no WATCHDOG=1 received in this seconds"`
+	/* restart on file changes, reload_signal is sent instead if configured */
+	Watch           []string `toml:"watch,omitempty" param:"watch,files or globs relative to cwd to watch, e.g. ./bin/api,./config/*.yaml"`
+	WatchIgnore     []string `toml:"watch_ignore,omitempty" param:"watch_ignore,globs of changed files to ignore, e.g. *.swp,*~"`
+	WatchDebounceMs int      `toml:"watch_debounce_ms,omitempty" param:"watch_debounce_ms,milliseconds without further change before restart, default 500"`
+	/* give up a crash loop with FATAL */
+	StartRetries int `toml:"start_retries,omitempty" param:"start_retries,give up with FATAL after process exits unexpectedly this many times in a row within 60s of start, default 0 restarts forever"`
+}
+
+// IsAutostart reports whether process is started by supervisord automatically
+func (self *ProcessConfig) IsAutostart() bool {
+	return self.Autostart == nil || *self.Autostart
 }
 
 func (self *ProcessConfig) ParseFlags(flags map[string]string) error {
@@ -104,6 +194,24 @@ func (self *ProcessConfig) FillDefaults() *ProcessConfig {
 	return self
 }
 
+// Validate checks process options which can not be applied, output must never bypass a bad log_redact
+func (self *ProcessConfig) Validate() error {
+	for _, expr := range self.LogRedact {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("bad log_redact %s of process %s: %v", expr, self.Name, err)
+		}
+	}
+	if self.StopSignal != "" {
+		if _, err := signals.ToSignal(self.StopSignal); err != nil {
+			return fmt.Errorf("bad stop_signal of process %s: %v", self.Name, err)
+		}
+	}
+	if _, err := ParseStopSequence(self.StopSequence); err != nil {
+		return fmt.Errorf("bad stop_sequence of process %s: %v", self.Name, err)
+	}
+	return nil
+}
+
 func (self *ProcessConfig) Clone() *ProcessConfig {
 	data, _ := json.Marshal(self)
 	n := new(ProcessConfig)
@@ -112,11 +220,62 @@ func (self *ProcessConfig) Clone() *ProcessConfig {
 }
 
 func (self *SupervisorConfig) IsBlank() bool {
+	return self.Same(new(SupervisorConfig))
+}
+
+// Same reports whether both configs are marshaled to the same content
+func (self *SupervisorConfig) Same(other *SupervisorConfig) bool {
 	bs1, err1 := config_marshal(self)
-	bs2, err2 := config_marshal(new(SupervisorConfig))
+	bs2, err2 := config_marshal(other)
 	return err1 == nil && err2 == nil && bytes.Equal(bs1, bs2)
 }
 
+// Validate checks config can be applied, process names must be unique and commands are required
+func (self *SupervisorConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, p := range self.Process {
+		if p.Name == "" {
+			return fmt.Errorf("process name is required")
+		}
+		if p.Command == "" {
+			return fmt.Errorf("command of process %s is required", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate process %s", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	for sig, action := range self.SignalPolicy {
+		if _, ok := defaultSignalPolicy[signalName(sig)]; !ok {
+			return fmt.Errorf("signal_policy: signal %s is not one of %s", sig, strings.Join(PolicySignals(), " "))
+		}
+		switch action {
+		case SignalStop, SignalForward, SignalReload, SignalIgnore:
+		default:
+			return fmt.Errorf("signal_policy: bad action %s of %s, expect stop forward reload or ignore", action, sig)
+		}
+	}
+	return nil
+}
+
+// SignalAction returns action of signal in signal_policy, e.g. SIGTERM or TERM
+func (self *SupervisorConfig) SignalAction(sig string) string {
+	sig = signalName(sig)
+	for name, action := range self.SignalPolicy {
+		if signalName(name) == sig {
+			return action
+		}
+	}
+	return defaultSignalPolicy[sig]
+}
+
+func signalName(sig string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(sig)), "SIG")
+}
+
 func (self *SupervisorConfig) ExistProcess(name string) bool {
 	for _, p := range self.Process {
 		if p.Name == name {
@@ -136,6 +295,18 @@ func (self *SupervisorConfig) AddProcessConfig(p *ProcessConfig) {
 	self.Process = append(self.Process, p)
 }
 
+// StateFilePath returns state_file or .supervisord.state next to supervisord.conf
+func (self *SupervisorConfig) StateFilePath() string {
+	if self.StateFile != "" {
+		return self.StateFile
+	}
+	dir := SupervisordDir()
+	if file, err := findSupervisordConf(); err == nil {
+		dir = filepath.Dir(file)
+	}
+	return filepath.Join(dir, ".supervisord.state")
+}
+
 func (self *SupervisorConfig) AdminListenAddr() string {
 	if self.AdminSock != "" {
 		return fmt.Sprintf("unix://%s", self.AdminSock)
@@ -164,13 +335,19 @@ func (self *SupervisorConfig) AdminDialAddr() string {
 	return fmt.Sprintf("%v:%v", self.AdminBindIP, self.AdminListen)
 }
 
-func supervisordDir() string {
+// SupervisordDir returns directory of supervisord binary, supervisord.conf is looked up next to it
+func SupervisordDir() string {
 	path, _ := filepath.Abs(sys.Args()[0])
 	return filepath.Dir(path)
 }
 
+// ConfigFile returns absolute path of supervisord.conf in use
+func ConfigFile() (string, error) {
+	return findSupervisordConf()
+}
+
 func findSupervisordConf() (string, error) {
-	dir := supervisordDir()
+	dir := SupervisordDir()
 	possibleSupervisordConf := []string{
 		filepath.Join(dir, `../conf/supervisord.conf`),
 		filepath.Join(dir, `supervisord.conf`),
@@ -246,6 +423,15 @@ func parseFlags(objectPtr interface{}, flags map[string]string) error {
 					return err
 				}
 				val.Field(i).SetBool(b)
+			case reflect.Ptr:
+				/* only *bool, nil means default */
+				if field.Type.Elem().Kind() == reflect.Bool {
+					b, err := strconv.ParseBool(str)
+					if err != nil {
+						return err
+					}
+					val.Field(i).Set(reflect.ValueOf(&b))
+				}
 			case reflect.Map:
 				/* only map[string]string */
 				val.Field(i).Set(reflect.ValueOf(ParseEnv(str).AsMap()))
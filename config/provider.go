@@ -62,7 +62,7 @@ func (self *defaultProvider) UpdateConfig(c *SupervisorConfig) error {
 		File:   oldinfo.File,
 	}
 	if info.File == "" {
-		info.File = filepath.Join(supervisordDir(), `../conf/supervisord.conf`)
+		info.File = filepath.Join(SupervisordDir(), `../conf/supervisord.conf`)
 	}
 	dir := filepath.Dir(info.File)
 	if _, err := os.Stat(dir); err != nil {
@@ -163,12 +163,21 @@ func (self *defaultProvider) CheckConfigFile() error {
 	if err != nil {
 		return err
 	}
+	_, err = LoadConfigFile(file)
+	return err
+}
+
+// LoadConfigFile parses and validates config file without applying it
+func LoadConfigFile(file string) (*SupervisorConfig, error) {
 	bytes, err := os.ReadFile(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = config_unmarshal(bytes)
-	return nil
+	cnf, err := config_unmarshal(bytes)
+	if err != nil {
+		return nil, err
+	}
+	return cnf, cnf.Validate()
 }
 
 func (self *defaultProvider) Close() error {
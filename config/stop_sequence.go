@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+const (
+	StopStepSignal = "signal"
+	StopStepWait   = "wait"
+	StopStepHTTP   = "http"
+	StopStepExec   = "exec"
+)
+
+// StopStep is one step of stop_sequence:
+//
+//	"TERM", "SIGUSR2", "signal HUP"   send signal to process group
+//	"wait 10s"                        wait for process exit at most 10s
+//	"http GET http://127.0.0.1/drain" send http request, method is optional and defaults to GET
+//	"exec ./bin/drain.sh"             run command by /bin/sh like hooks
+type StopStep struct {
+	Kind    string
+	Text    string
+	SigName string
+	Signal  os.Signal
+	Wait    time.Duration
+	Method  string
+	URL     string
+	Command string
+}
+
+func (s StopStep) String() string {
+	return s.Text
+}
+
+// ParseStopSequence parses stop_sequence, empty items are skipped
+func ParseStopSequence(list []string) ([]StopStep, error) {
+	var steps []StopStep
+	for _, item := range list {
+		text := strings.TrimSpace(item)
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		step := StopStep{Text: text}
+		switch strings.ToLower(fields[0]) {
+		case StopStepWait:
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("bad stop step %q, expect: wait DURATION", text)
+			}
+			d, err := time.ParseDuration(fields[1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("bad stop step %q: bad duration", text)
+			}
+			step.Kind, step.Wait = StopStepWait, d
+		case StopStepHTTP:
+			step.Kind, step.Method = StopStepHTTP, http.MethodGet
+			switch len(fields) {
+			case 2:
+				step.URL = fields[1]
+			case 3:
+				step.Method, step.URL = strings.ToUpper(fields[1]), fields[2]
+			default:
+				return nil, fmt.Errorf("bad stop step %q, expect: http [METHOD] URL", text)
+			}
+		case StopStepExec:
+			command := strings.TrimSpace(text[len(fields[0]):])
+			if command == "" {
+				return nil, fmt.Errorf("bad stop step %q, expect: exec COMMAND", text)
+			}
+			step.Kind, step.Command = StopStepExec, command
+		case StopStepSignal:
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("bad stop step %q, expect: signal NAME", text)
+			}
+			fields = fields[1:]
+			fallthrough
+		default:
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("bad stop step %q", text)
+			}
+			sig, err := signals.ToSignal(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("bad stop step %q: %v", text, err)
+			}
+			step.Kind, step.SigName, step.Signal = StopStepSignal, strings.TrimPrefix(strings.ToUpper(fields[0]), "SIG"), sig
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
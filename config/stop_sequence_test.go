@@ -0,0 +1,52 @@
+package config
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStopSequence(t *testing.T) {
+	steps, err := ParseStopSequence([]string{"SIGUSR2", "wait 10s", "http POST http://127.0.0.1/drain", "exec ./drain.sh --now", "signal term", "KILL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 6 {
+		t.Fatalf("bad steps %v", steps)
+	}
+	if steps[0].Signal != syscall.SIGUSR2 || steps[0].SigName != "USR2" {
+		t.Fatalf("bad signal step %+v", steps[0])
+	}
+	if steps[1].Kind != StopStepWait || steps[1].Wait != 10*time.Second {
+		t.Fatalf("bad wait step %+v", steps[1])
+	}
+	if steps[2].Method != "POST" || steps[2].URL != "http://127.0.0.1/drain" {
+		t.Fatalf("bad http step %+v", steps[2])
+	}
+	if steps[3].Command != "./drain.sh --now" {
+		t.Fatalf("bad exec step %+v", steps[3])
+	}
+	if steps[4].Signal != syscall.SIGTERM || steps[5].Signal != syscall.SIGKILL {
+		t.Fatalf("bad signal steps %+v", steps[4:])
+	}
+	for _, bad := range []string{"SIGFOO", "wait", "wait 0s", "http", "exec", "signal"} {
+		if _, err := ParseStopSequence([]string{bad}); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestBadStopSequenceRejected(t *testing.T) {
+	for _, cnf := range []*ProcessConfig{
+		{Name: "bad", Command: "/bin/true", StopSequence: []string{"TERM", "wiat 5s"}},
+		{Name: "bad", Command: "/bin/true", StopSignal: "TREM"},
+	} {
+		if err := (&SupervisorConfig{Process: []*ProcessConfig{cnf.FillDefaults()}}).Validate(); err == nil {
+			t.Fatalf("bad stop config %v %v should be rejected", cnf.StopSequence, cnf.StopSignal)
+		}
+	}
+	good := (&ProcessConfig{Name: "good", Command: "/bin/true", StopSequence: []string{"TERM", "wait 5s", "KILL"}}).FillDefaults()
+	if err := (&SupervisorConfig{Process: []*ProcessConfig{good}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,16 @@
 package ctl
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -38,6 +42,12 @@ func getAdminClient() (chttp.Client, error) {
 		}), nil
 }
 
+// IsRunning reports whether supervisord admin server is reachable
+func IsRunning() bool {
+	_, err := getAdminClient()
+	return err == nil
+}
+
 func StartProcess(ctx context.Context, name string) error {
 	return controlProcess(ctx, fmt.Sprintf(`/start?name=%s`, name))
 }
@@ -50,6 +60,72 @@ func RestartProcess(ctx context.Context, name string) error {
 	return controlProcess(ctx, fmt.Sprintf(`/restart?name=%s`, name))
 }
 
+// RollingRestart prints progress of rolling restart, error is returned if any batch failed
+func RollingRestart(ctx context.Context, selector string, batch int, waitHealthy time.Duration) error {
+	client, err := getAdminClient()
+	if err != nil {
+		return err
+	}
+	path := addQuery(fmt.Sprintf(`/rolling_restart?name=%s&batch=%d&wait_healthy=%s`, url.QueryEscape(selector), batch, waitHealthy))
+	return client.Get(ctx, fmt.Sprintf(`%s%s`, adminBaseURL, path), chttp.WithTimeout(0)).
+		HandleResult(func(res *http.Response) error {
+			if res.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(res.Body)
+				return errors.New(strings.TrimSpace(string(body)))
+			}
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				var pg daemon.RollingProgress
+				if err := json.Unmarshal(scanner.Bytes(), &pg); err != nil {
+					continue
+				}
+				if pg.Done {
+					if pg.Failed {
+						return errors.New(pg.Message)
+					}
+					fmt.Println(pg.Message)
+					return nil
+				}
+				fmt.Println(formatRollingProgress(&pg))
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return errors.New("rolling restart interrupted")
+		})
+}
+
+func formatRollingProgress(pg *daemon.RollingProgress) string {
+	text := fmt.Sprintf("[batch %d/%d]", pg.Batch, pg.Batches)
+	if pg.Process != "" {
+		text += " " + pg.Process + ":"
+	}
+	if pg.Failed {
+		text += " FAIL"
+	}
+	return text + " " + pg.Message
+}
+
+func RunProcessNow(ctx context.Context, name string) error {
+	return controlProcess(ctx, fmt.Sprintf(`/run_now?name=%s`, name))
+}
+
+func PauseProcess(ctx context.Context, name string) error {
+	return controlProcess(ctx, fmt.Sprintf(`/pause?name=%s`, name))
+}
+
+func ResumeProcess(ctx context.Context, name string) error {
+	return controlProcess(ctx, fmt.Sprintf(`/resume?name=%s`, name))
+}
+
+func SignalProcess(ctx context.Context, selector string, sig string, leaderOnly bool) error {
+	return controlProcess(ctx, fmt.Sprintf(`/signal?name=%s&sig=%s&leader=%t`, url.QueryEscape(selector), url.QueryEscape(sig), leaderOnly))
+}
+
+func SignalReloadProcess(ctx context.Context, name string) error {
+	return controlProcess(ctx, fmt.Sprintf(`/signal_reload?name=%s`, name))
+}
+
 func OmitProcessExitCode(ctx context.Context, name string) error {
 	return controlProcess(ctx, fmt.Sprintf(`/omit_exit_code?name=%s`, name))
 }
@@ -74,10 +150,110 @@ func Reload(ctx context.Context) error {
 	return controlProcess(ctx, `/reload`)
 }
 
+// Upgrade replaces running supervisord by binary and waits new one serving
+func Upgrade(ctx context.Context, binary string) error {
+	client, err := getAdminClient()
+	if err != nil {
+		return err
+	}
+	path := addQuery(fmt.Sprintf(`/upgrade?binary=%s`, url.QueryEscape(binary)))
+	err = client.Get(ctx, fmt.Sprintf(`%s%s`, adminBaseURL, path), chttp.WithTimeout(0)).
+		HandleResult(func(res *http.Response) error {
+			if res.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(res.Body)
+				return errors.New(strings.TrimSpace(string(body)))
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		if _, err := requestProcess(ctx, `/status`); err == nil {
+			fmt.Println("OK")
+			return nil
+		}
+	}
+	return errors.New("supervisord is not serving after upgrade, check its log")
+}
+
+// PurgeDryRun prints files supervisord would remove by shutdown --clear
+func PurgeDryRun(ctx context.Context) error {
+	client, err := getAdminClient()
+	if err != nil {
+		return err
+	}
+	return client.Get(ctx, fmt.Sprintf(`%s%s`, adminBaseURL, addQuery(`/purge_dry_run`))).
+		HandleResult(func(res *http.Response) error {
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != http.StatusOK {
+				var result struct{ Message string }
+				if json.Unmarshal(body, &result) == nil && result.Message != "" {
+					return errors.New(result.Message)
+				}
+				return errors.New(strings.TrimSpace(string(body)))
+			}
+			if text := strings.TrimSpace(string(body)); text != "" {
+				fmt.Println(text)
+			}
+			return nil
+		})
+}
+
 func Status(ctx context.Context) error {
 	return controlProcess(ctx, `/status`)
 }
 
+func LogUsage(ctx context.Context) error {
+	return controlProcess(ctx, `/log_usage`)
+}
+
+// Events prints process events stream until interrupted
+func Events(ctx context.Context, names []string, types []string) error {
+	client, err := getAdminClient()
+	if err != nil {
+		return err
+	}
+	path := addQuery(fmt.Sprintf(`/events?name=%s&type=%s`, url.QueryEscape(strings.Join(names, ",")), url.QueryEscape(strings.Join(types, ","))))
+	return client.Get(ctx, fmt.Sprintf(`%s%s`, adminBaseURL, path), chttp.WithTimeout(0)).
+		HandleResult(func(res *http.Response) error {
+			if res.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(res.Body)
+				return errors.New(strings.TrimSpace(string(body)))
+			}
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				var e daemon.Event
+				if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+					continue
+				}
+				fmt.Println(formatEvent(&e))
+			}
+			return scanner.Err()
+		})
+}
+
+func formatEvent(e *daemon.Event) string {
+	text := fmt.Sprintf("[%s] %-15s", time.Unix(e.Time, 0).Format(`2006-01-02 15:04:05`), e.Type)
+	if e.Name != "" {
+		text += " " + e.Name
+	}
+	if e.PID > 0 {
+		text += fmt.Sprintf(" pid=%d", e.PID)
+	}
+	if e.Type == daemon.EventExited {
+		text += fmt.Sprintf(" exit_code=%d expected=%t", e.ExitCode, e.Expected)
+	}
+	if e.FromState != "" {
+		text += fmt.Sprintf(" from=%s", e.FromState)
+	}
+	if e.Message != "" {
+		text += " " + e.Message
+	}
+	return text
+}
+
 func DumpEnv(ctx context.Context) error {
 	var states []daemon.ProcessState
 	result, _ := requestProcess(ctx, `/status?format=json`)
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +23,8 @@ import (
 
 func startAdminServer(addr string) func() {
 	s := myhttp.NewServer()
+	/* closed on server stop to terminate streaming requests */
+	closed := make(chan struct{})
 	renderSuccess := func(w http.ResponseWriter, text string) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, text)
@@ -104,15 +107,93 @@ func startAdminServer(addr string) func() {
 		}
 		renderSuccess(w, "OK")
 	})
+	s.GET("/rolling_restart", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] rolling restart %s", extractParams(r))
+		query := r.URL.Query()
+		batch, _ := strconv.Atoi(query.Get("batch"))
+		var waitHealthy time.Duration
+		if str := query.Get("wait_healthy"); str != "" {
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				renderError(w, err)
+				return
+			}
+			waitHealthy = d
+		}
+		if _, err := Get().selectProcesses(query.Get("name")); err != nil {
+			renderError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		progress := func(pg *RollingProgress) {
+			enc.Encode(pg)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err := Get().RollingRestart(r.Context(), query.Get("name"), batch, waitHealthy, progress); err != nil {
+			progress(&RollingProgress{Message: err.Error(), Failed: true, Done: true})
+			return
+		}
+		progress(&RollingProgress{Message: "OK", Done: true})
+	})
+	s.GET("/run_now", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] run now %s", extractParams(r))
+		if err := Get().RunProcessNow(context.Background(), r.URL.Query().Get("name")); err != nil {
+			renderError(w, err)
+			return
+		}
+		renderSuccess(w, "OK")
+	})
+	s.GET("/pause", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] pause %s", extractParams(r))
+		if err := Get().PauseProcess(context.Background(), r.URL.Query().Get("name")); err != nil {
+			renderError(w, err)
+			return
+		}
+		renderSuccess(w, "OK")
+	})
+	s.GET("/resume", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] resume %s", extractParams(r))
+		if err := Get().ResumeProcess(context.Background(), r.URL.Query().Get("name")); err != nil {
+			renderError(w, err)
+			return
+		}
+		renderSuccess(w, "OK")
+	})
+	s.GET("/signal", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] signal %s", extractParams(r))
+		q := r.URL.Query()
+		if err := Get().SignalProcess(r.Context(), q.Get("name"), q.Get("sig"), q.Get("leader") == "true"); err != nil {
+			renderError(w, err)
+			return
+		}
+		renderSuccess(w, "OK")
+	})
+	s.GET("/signal_reload", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] signal reload %s", extractParams(r))
+		if err := Get().SignalReloadProcess(r.Context(), r.URL.Query().Get("name")); err != nil {
+			renderError(w, err)
+			return
+		}
+		renderSuccess(w, "OK")
+	})
 	s.GET("/reload", func(w http.ResponseWriter, r *http.Request) {
 		logger.Log("[admin-api] reload %s", extractParams(r))
-		if err := config.Provider().CheckConfigFile(); err != nil {
+		if err := Get().CheckAndReload(); err != nil {
 			logger.Log("reload config %v", err)
 			renderError(w, err)
 			return
 		}
-		if err := Get().Reload(); err != nil {
-			logger.Log("reload config %v", err)
+		renderSuccess(w, "OK")
+	})
+	s.GET("/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] upgrade %s", extractParams(r))
+		if err := Get().Upgrade(r.URL.Query().Get("binary")); err != nil {
+			logger.Log("upgrade %v", err)
 			renderError(w, err)
 			return
 		}
@@ -183,6 +264,83 @@ func startAdminServer(addr string) func() {
 		})
 		renderSuccess(w, "OK")
 	})
+	s.GET("/purge_dry_run", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] purge dry run %s", extractParams(r))
+		/* files of runtime config, processes added by add-proc included */
+		var text strings.Builder
+		if err := PurgeLogs(true, &text); err != nil {
+			renderError(w, fmt.Errorf("%s%v", text.String(), err))
+			return
+		}
+		renderSuccess(w, text.String())
+	})
+	s.GET("/log_usage", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] log usage %s", extractParams(r))
+		usage := Get().GetLogUsage()
+		if r.URL.Query().Get("format") == `json` {
+			renderObject(w, usage)
+			return
+		}
+		var text strings.Builder
+		t := table.NewWriter()
+		t.SetOutputMirror(&text)
+		t.AppendHeader(table.Row{"file", "size", "modify-time", "active"})
+		for _, f := range usage.Files {
+			t.AppendRow([]any{f.Path, f.Size, time.Unix(f.ModTime, 0), f.Active})
+		}
+		t.AppendFooter(table.Row{"total", usage.Used, "quota", usage.Quota})
+		t.SetStyle(table.StyleLight)
+		t.Render()
+		renderSuccess(w, text.String())
+	})
+	s.GET("/events", func(w http.ResponseWriter, r *http.Request) {
+		logger.Log("[admin-api] events %s", extractParams(r))
+		query := r.URL.Query()
+		filter := EventFilter{
+			Names: splitParam(query.Get("name")),
+			Types: splitParam(query.Get("type")),
+		}
+		sse := query.Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+		ch, cancel := events.Subscribe(filter, 128)
+		defer cancel()
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		flush := func() {
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		flush()
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e := <-ch:
+				data, _ := json.Marshal(e)
+				if sse {
+					fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Serial, e.Type, data)
+				} else {
+					fmt.Fprintf(w, "%s\n", data)
+				}
+				flush()
+			case <-heartbeat.C:
+				if sse {
+					fmt.Fprint(w, ": heartbeat\n\n")
+					flush()
+				}
+			case <-r.Context().Done():
+				return
+			case <-closed:
+				return
+			}
+		}
+	})
 	s.GET("/status", func(w http.ResponseWriter, r *http.Request) {
 		logger.Log("[admin-api] status %s", extractParams(r))
 		processList := Get().GetProcessList()
@@ -198,7 +356,7 @@ func startAdminServer(addr string) func() {
 		var text strings.Builder
 		t := table.NewWriter()
 		t.SetOutputMirror(&text)
-		row := table.Row{"name", "pid", "state", "start-time", "stop-time", "restart"}
+		row := table.Row{"name", "pid", "state", "start-time", "stop-time", "restart", "status"}
 		t.AppendHeader(row)
 		for _, p := range processList {
 			state := p.GetState()
@@ -209,6 +367,7 @@ func startAdminServer(addr string) func() {
 				time.Unix(state.StartTime, 0),
 				time.Unix(state.StopTime, 0),
 				state.Restart,
+				statusText(state),
 			})
 		}
 		t.SetStyle(table.StyleLight)
@@ -216,16 +375,17 @@ func startAdminServer(addr string) func() {
 		renderSuccess(w, text.String())
 	})
 	go func() {
-		network := "tcp"
-		if sock, ok := strings.CutPrefix(addr, "unix://"); ok {
-			network = "unix"
-			addr = sock
+		ln, err := listenAdmin(addr)
+		if err != nil {
+			logger.Log("listen err %v", err)
+			return
 		}
-		if err := s.ListenAndServe(network, addr); err != nil && err != http.ErrServerClosed {
+		if err := s.Serve(ln); err != nil && err != http.ErrServerClosed {
 			logger.Log("listen err %v", err)
 		}
 	}()
 	return func() {
+		close(closed)
 		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 		defer cancel()
 		if err := s.Close(ctx); err != nil && !strings.Contains(err.Error(), "context deadline exceeded") {
@@ -293,6 +453,39 @@ func (self *scriptWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// statusText joins sd_notify status and run info of jobs
+func statusText(state ProcessState) string {
+	var list []string
+	if state.Status != "" {
+		list = append(list, state.Status)
+	}
+	if state.Config.Schedule != "" || state.Config.Type == ProcessTypeOneshot {
+		if state.StartTime > 0 {
+			list = append(list, "last run "+time.Unix(state.StartTime, 0).Format("2006-01-02 15:04:05"))
+		}
+		if state.ExitCode != nil {
+			list = append(list, fmt.Sprintf("exit %d", *state.ExitCode))
+		}
+		if state.NextRun > 0 {
+			list = append(list, "next run "+time.Unix(state.NextRun, 0).Format("2006-01-02 15:04:05"))
+		}
+	}
+	if len(state.Orphans) > 0 {
+		list = append(list, fmt.Sprintf("orphans %v", state.Orphans))
+	}
+	return strings.Join(list, ", ")
+}
+
+func splitParam(str string) []string {
+	var list []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func extractParams(r *http.Request) string {
 	vals, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
@@ -0,0 +1,437 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+	"github.com/qjpcpu/supervisord/reaper"
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+/* how often an adopted process which is not our child is checked */
+var adoptPollInterval = time.Second
+
+/* time given to output reader to drain fifo after process exited */
+const fifoDrainTimeout = time.Second
+
+// processRecord is a running process persisted in state file, the process is adopted on next start
+// if it is still alive with same start time and its config is not changed
+type processRecord struct {
+	Name       string
+	PID        int
+	StartTime  uint64 /* clock ticks after boot in /proc/<pid>/stat, tells pid reuse */
+	ConfigHash string
+	Started    int64
+}
+
+type daemonState struct {
+	Processes []*processRecord
+	/* processes kept done or stopped on next start */
+	Done    []string `json:",omitempty"`
+	Stopped []string `json:",omitempty"`
+}
+
+func loadState(file string) (*daemonState, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	state := new(daemonState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveState writes state file by rename so a crash never leaves a partial file
+func saveState(file string, state *daemonState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(file), 0755)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func configHash(c *config.ProcessConfig) string {
+	c = c.Clone()
+	c.OmitExitCode = false
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// procInfo is a process read from /proc/<pid>/stat
+type procInfo struct {
+	PID, PPID, PGID, SID int
+	State                byte
+	StartTime            uint64 /* clock ticks after boot */
+}
+
+func readProcInfo(pid int) (*procInfo, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	/* comm may contain spaces and parentheses, fields after it are plain */
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return nil, fmt.Errorf("bad stat of pid %d", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 || len(fields[0]) == 0 {
+		return nil, fmt.Errorf("bad stat of pid %d", pid)
+	}
+	/* fields start at state(3), ppid is 4, pgrp 5, session 6 and starttime is 22 */
+	info := &procInfo{PID: pid, State: fields[0][0]}
+	for j, v := range []*int{&info.PPID, &info.PGID, &info.SID} {
+		if *v, err = strconv.Atoi(fields[j+1]); err != nil {
+			return nil, err
+		}
+	}
+	if info.StartTime, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// procStat returns parent pid and start time of pid from /proc/<pid>/stat
+func procStat(pid int) (ppid int, startTime uint64, err error) {
+	info, err := readProcInfo(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.PPID, info.StartTime, nil
+}
+
+func (rec *processRecord) alive() bool {
+	_, startTime, err := procStat(rec.PID)
+	return err == nil && startTime == rec.StartTime
+}
+
+// record returns state of running process, nil if process is not running
+func (p *Process) record() *processRecord {
+	p.runMu.RLock()
+	cmd, state, started, hash := p.cmd, p.state, p.startTime, configHash(p.config)
+	p.runMu.RUnlock()
+	if !state.Active() || cmd == nil || cmd.Process == nil || !p.isRunning() {
+		return nil
+	}
+	_, startTime, err := procStat(cmd.Process.Pid)
+	if err != nil {
+		return nil
+	}
+	return &processRecord{
+		Name:       p.config.Name,
+		PID:        cmd.Process.Pid,
+		StartTime:  startTime,
+		ConfigHash: hash,
+		Started:    started,
+	}
+}
+
+// keepChildren makes process survive supervisord exit, output goes through named pipes in fifoDir
+func (p *Process) keepChildren(fifoDir string) {
+	if p.listener != nil {
+		/* stdout of event listener is its protocol channel with supervisord */
+		return
+	}
+	p.fifoDir = fifoDir
+}
+
+// Adopt monitors process left running by previous supervisord instead of starting a new one
+func (p *Process) Adopt(rec *processRecord) error {
+	p.adoption = rec
+	err := p.start()
+	if p.cron != nil {
+		p.cron.Arm()
+	}
+	return err
+}
+
+func (p *Process) runProcessAdopt(rec *processRecord) error {
+	cmd, err := p.newCommand(p.config.Command, p.config.Args...)
+	if err != nil {
+		return err
+	}
+	proc, err := os.FindProcess(rec.PID)
+	if err != nil {
+		return err
+	}
+	cmd.Process = proc
+	stdout, stderr, writers, err := p.createWriters()
+	if err != nil {
+		return err
+	}
+	out := newOutputWriters(stdout, stderr, writers)
+	output, err := openFifoOutput(p.fifoDir, p.config.Name, false)
+	if err != nil {
+		out.release()
+		return err
+	}
+	output.copyTo(out.stdout, out.stderr)
+	p.setWriters(out)
+	p.output = output
+	done := make(chan struct{})
+	p.runMu.Lock()
+	p.cmd, p.notifier, p.waitDone = cmd, nil, done
+	p.startTime = rec.Started
+	p.runMu.Unlock()
+	go func() {
+		/* results are read after done is closed */
+		p.waitErr = p.waitAdopted(rec, cmd)
+		close(done)
+	}()
+	logger.Log("process %s adopted, pid %d", p.config.Name, rec.PID)
+	return nil
+}
+
+// waitAdopted waits adopted process exits, exit status is known only if it is still our child
+func (p *Process) waitAdopted(rec *processRecord, cmd *exec.Cmd) error {
+	if ppid, _, err := procStat(rec.PID); err == nil && ppid == os.Getpid() {
+		code, err := reaper.WaitProcess(cmd.Process)
+		var exitErr interface{ ExitCode() int }
+		if err == nil || errors.As(err, &exitErr) {
+			p.waitCode = code
+			return err
+		}
+	}
+	for rec.alive() {
+		time.Sleep(adoptPollInterval)
+	}
+	p.waitCode = -1
+	return errors.New("adopted process exited, exit code unknown")
+}
+
+// terminateStale stops a left running process which can not be adopted
+func terminateStale(rec *processRecord, reason string) {
+	if !rec.alive() {
+		return
+	}
+	logger.Log("stop process %s pid %d left by previous supervisord, %s", rec.Name, rec.PID, reason)
+	if proc, err := os.FindProcess(rec.PID); err == nil {
+		signals.Kill(proc, syscall.SIGTERM, true)
+	}
+}
+
+// attachFifoOutput connects cmd output to named pipes and lets it outlive supervisord
+func (p *Process) attachFifoOutput(cmd *exec.Cmd) error {
+	out, err := openFifoOutput(p.fifoDir, p.config.Name, true)
+	if err != nil {
+		return err
+	}
+	out.copyTo(cmd.Stdout, cmd.Stderr)
+	cmd.Stdout, cmd.Stderr = out.children[0], out.children[1]
+	cmd.SysProcAttr.Pdeathsig = 0
+	p.output = out
+	return nil
+}
+
+// fifoOutput carries stdout and stderr of process through named pipes, the process holds both ends
+// of each pipe so it never gets SIGPIPE while no supervisord is reading
+type fifoOutput struct {
+	children []*os.File
+	readers  []*os.File
+	wg       sync.WaitGroup
+}
+
+func fifoPaths(dir, name string) []string {
+	return []string{filepath.Join(dir, name+".stdout"), filepath.Join(dir, name+".stderr")}
+}
+
+// openFifoOutput opens read ends of process fifos, write ends for child are created too if forChild
+func openFifoOutput(dir, name string, forChild bool) (*fifoOutput, error) {
+	out := new(fifoOutput)
+	for _, path := range fifoPaths(dir, name) {
+		if forChild {
+			os.MkdirAll(dir, 0755)
+			os.Remove(path)
+			if err := syscall.Mkfifo(path, 0600); err != nil {
+				out.Close()
+				return nil, err
+			}
+			child, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			out.children = append(out.children, child)
+		}
+		/* non-blocking open never waits for a writer */
+		reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		out.readers = append(out.readers, reader)
+	}
+	return out, nil
+}
+
+func (out *fifoOutput) copyTo(stdout, stderr io.Writer) {
+	for i, w := range []io.Writer{stdout, stderr} {
+		out.wg.Add(1)
+		go func(r *os.File, w io.Writer) {
+			defer out.wg.Done()
+			io.Copy(w, r)
+		}(out.readers[i], w)
+	}
+}
+
+// started closes write ends held by supervisord, readers get EOF once process exits
+func (out *fifoOutput) started() {
+	for _, f := range out.children {
+		f.Close()
+	}
+	out.children = nil
+}
+
+// Close waits readers drain output for a while and closes them
+func (out *fifoOutput) Close() {
+	out.started()
+	drained := make(chan struct{})
+	go func() {
+		out.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(fifoDrainTimeout):
+	}
+	for _, f := range out.readers {
+		f.Close()
+	}
+	out.readers = nil
+}
+
+// loadState reads processes left by previous supervisord from state file
+func (s *Supervisord) loadState() {
+	state, err := loadState(s.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Log("load state file %s fail %v", s.stateFile, err)
+		}
+		return
+	}
+	s.adoptions = make(map[string]*processRecord)
+	for _, rec := range state.Processes {
+		s.adoptions[rec.Name] = rec
+	}
+	s.idle = make(map[string]string)
+	for _, name := range state.Stopped {
+		s.idle[name] = "stopped"
+	}
+	for _, name := range state.Done {
+		s.idle[name] = "done"
+	}
+}
+
+// restoreIdle keeps process done or stopped as recorded in state file, it reports whether process is kept
+func (s *Supervisord) restoreIdle(name string) bool {
+	switch s.idle[name] {
+	case "done":
+		s.processDone.Store(name, struct{}{})
+	case "stopped":
+	default:
+		return false
+	}
+	logger.Log("process %s was %s before restart, keep it", name, s.idle[name])
+	return true
+}
+
+// takeAdoption returns record of process which can be adopted
+func (s *Supervisord) takeAdoption(cnf *config.ProcessConfig) *processRecord {
+	rec := s.adoptions[cnf.Name]
+	delete(s.adoptions, cnf.Name)
+	switch {
+	case rec == nil:
+		return nil
+	case !rec.alive():
+		logger.Log("process %s pid %d left by previous supervisord is gone", rec.Name, rec.PID)
+		return nil
+	case rec.ConfigHash != configHash(cnf):
+		terminateStale(rec, "config changed")
+		return nil
+	}
+	return rec
+}
+
+// finishRestore stops processes in state file which are not adopted
+func (s *Supervisord) finishRestore() {
+	for _, rec := range s.adoptions {
+		terminateStale(rec, "process removed from config")
+	}
+	s.adoptions, s.idle = nil, nil
+}
+
+// keepState saves running processes to state file on every process event
+func (s *Supervisord) keepState() {
+	ch, cancel := events.Subscribe(EventFilter{}, 64)
+	s.stateCancel = cancel
+	go func() {
+		for range ch {
+			/* one save for a burst of events */
+			for len(ch) > 0 {
+				<-ch
+			}
+			s.saveState()
+		}
+	}()
+	s.saveState()
+}
+
+func (s *Supervisord) saveState() {
+	s.processMutex.RLock()
+	state := new(daemonState)
+	for name, p := range s.processMap {
+		_, done := s.processDone.Load(name)
+		switch {
+		case done:
+			state.Done = append(state.Done, name)
+		case p.currentState() == Stopped && !p.isJob():
+			state.Stopped = append(state.Stopped, name)
+		case p.fifoDir != "":
+			if rec := p.record(); rec != nil {
+				state.Processes = append(state.Processes, rec)
+			}
+		}
+	}
+	s.processMutex.RUnlock()
+	sort.Slice(state.Processes, func(i, j int) bool { return state.Processes[i].Name < state.Processes[j].Name })
+	sort.Strings(state.Done)
+	sort.Strings(state.Stopped)
+	if err := saveState(s.stateFile, state); err != nil {
+		logger.Log("save state file %s fail %v", s.stateFile, err)
+	}
+}
+
+// clearState removes state file and fifos after all processes are stopped
+func (s *Supervisord) clearState() {
+	if s.stateCancel != nil {
+		s.stateCancel()
+	}
+	os.Remove(s.stateFile)
+	os.RemoveAll(s.fifoDir())
+}
+
+func (s *Supervisord) fifoDir() string {
+	return s.stateFile + ".fifo"
+}
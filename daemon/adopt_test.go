@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func tickerConfig(dir string) *config.ProcessConfig {
+	return (&config.ProcessConfig{
+		Name:    "ticker",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `while true; do echo tick; sleep 0.05; done`},
+		Stdout:  []string{filepath.Join(dir, "ticker.log")},
+	}).FillDefaults()
+}
+
+func fileSize(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func TestKeepChildren(t *testing.T) {
+	dir := t.TempDir()
+	cnf := tickerConfig(dir)
+	p := NewProcess(cnf, func(bool) {})
+	p.keepChildren(filepath.Join(dir, "fifo"))
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	if p.command().SysProcAttr.Pdeathsig != 0 {
+		t.Fatal("kept child should not be killed with supervisord")
+	}
+	rec := p.record()
+	if rec == nil || rec.PID != p.command().Process.Pid || rec.ConfigHash != configHash(cnf) || !rec.alive() {
+		t.Fatalf("bad record %+v", rec)
+	}
+	if fileSize(filepath.Join(dir, "ticker.log")) == 0 {
+		t.Fatal("output should go through fifo")
+	}
+	p.Stop(false)
+	if p.record() != nil || rec.alive() {
+		t.Fatal("stopped process should not be recorded")
+	}
+}
+
+// startOrphan starts ticker like a kept child of a crashed supervisord
+func startOrphan(t *testing.T, dir string, cnf *config.ProcessConfig) *processRecord {
+	out, err := openFifoOutput(dir, cnf.Name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(cnf.Command, cnf.Args...)
+	cmd.Stdout, cmd.Stderr = out.children[0], out.children[1]
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	_, startTime, err := procStat(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &processRecord{Name: cnf.Name, PID: cmd.Process.Pid, StartTime: startTime, ConfigHash: configHash(cnf), Started: 1}
+}
+
+func TestAdoptProcess(t *testing.T) {
+	dir := t.TempDir()
+	cnf := tickerConfig(dir)
+	rec := startOrphan(t, filepath.Join(dir, "fifo"), cnf)
+	s := &Supervisord{adoptions: map[string]*processRecord{"ticker": rec}}
+	if s.takeAdoption(cnf) != rec {
+		t.Fatal("live process with same config should be adopted")
+	}
+
+	p := NewProcess(cnf, func(bool) {})
+	p.keepChildren(filepath.Join(dir, "fifo"))
+	if err := p.Adopt(rec); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	st := p.GetState()
+	if st.State != Running || st.PID != strconv.Itoa(rec.PID) || st.StartTime != 1 {
+		t.Fatalf("bad state %+v", st)
+	}
+	time.Sleep(200 * time.Millisecond)
+	size := fileSize(filepath.Join(dir, "ticker.log"))
+	time.Sleep(300 * time.Millisecond)
+	if size == 0 || fileSize(filepath.Join(dir, "ticker.log")) <= size {
+		t.Fatal("output of adopted process should be reattached")
+	}
+	p.Stop(false)
+	if p.GetState().State != Stopped || rec.alive() {
+		t.Fatal("adopted process should be stopped")
+	}
+}
+
+func TestTerminateStale(t *testing.T) {
+	dir := t.TempDir()
+	cnf := tickerConfig(dir)
+	rec := startOrphan(t, filepath.Join(dir, "fifo"), cnf)
+	changed := cnf.Clone()
+	changed.Args = []string{"-c", "sleep 1"}
+	s := &Supervisord{adoptions: map[string]*processRecord{"ticker": rec}}
+	if s.takeAdoption(changed) != nil {
+		t.Fatal("process with changed config should not be adopted")
+	}
+	proc, _ := os.FindProcess(rec.PID)
+	proc.Wait()
+	if rec.alive() {
+		t.Fatal("stale process should be stopped")
+	}
+}
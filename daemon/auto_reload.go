@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+/* editors write config in several steps, wait them done before reload */
+const configWatchDebounce = time.Second
+
+// configWatcher reloads supervisord when supervisord.conf changes while auto_reload is on, it is the only
+// file watched since config has no include support
+type configWatcher struct {
+	mu      sync.Mutex
+	watcher *fileWatcher
+	reload  func() error
+}
+
+func newConfigWatcher(reload func() error) *configWatcher {
+	return &configWatcher{reload: reload}
+}
+
+// Reload starts or stops watching by auto_reload of cnf
+func (w *configWatcher) Reload(cnf *config.SupervisorConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !cnf.AutoReload {
+		if w.watcher != nil {
+			logger.Log("stop watching config file")
+			w.watcher.Close()
+			w.watcher = nil
+		}
+		return
+	}
+	if w.watcher != nil {
+		return
+	}
+	file, err := config.ConfigFile()
+	if err != nil {
+		logger.Log("watch config file fail %v", err)
+		return
+	}
+	watcher, err := newFileWatcher(filepath.Dir(file), []string{file}, nil, configWatchDebounce, w.onChange)
+	if err != nil {
+		logger.Log("watch config file %s fail %v", file, err)
+		return
+	}
+	logger.Log("watch config file %s", file)
+	w.watcher = watcher
+}
+
+func (w *configWatcher) onChange(file string) {
+	cnf, err := config.LoadConfigFile(file)
+	if err != nil {
+		logger.Log("reject invalid config %s, keep running state %v", file, err)
+		return
+	}
+	/* content written by supervisord itself e.g. add-proc is already applied */
+	if cnf.Same(config.Provider().GetConfig()) {
+		return
+	}
+	logger.Log("config file %s changed, reload", file)
+	if err := w.reload(); err != nil {
+		logger.Log("reload config %v", err)
+	}
+}
+
+func (w *configWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watcher != nil {
+		w.watcher.Close()
+		w.watcher = nil
+	}
+}
@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestConfigWatcherOnChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "supervisord.conf")
+	var reloads int
+	w := newConfigWatcher(func() error { reloads++; return nil })
+	change := func(content string) int {
+		os.WriteFile(file, []byte(content), 0644)
+		reloads = 0
+		w.onChange(file)
+		return reloads
+	}
+
+	if n := change("[[process]\nname = 1"); n != 0 {
+		t.Fatal("broken config should be rejected")
+	}
+	if n := change("[[process]]\nname = \"a\"\ncommand = \"sleep\"\n[[process]]\nname = \"a\"\ncommand = \"sleep\"\n"); n != 0 {
+		t.Fatal("duplicate process should be rejected")
+	}
+	current, _ := toml.Marshal(config.Provider().GetConfig())
+	if n := change(string(current)); n != 0 {
+		t.Fatal("unchanged config should not be reloaded")
+	}
+	if n := change("[[process]]\nname = \"a\"\ncommand = \"sleep\"\n"); n != 1 {
+		t.Fatal("changed config should be reloaded")
+	}
+}
@@ -0,0 +1,38 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestAutostart(t *testing.T) {
+	cnf := &config.ProcessConfig{Name: "manual"}
+	if err := cnf.ParseFlags(map[string]string{"autostart": "false", "start_delay": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if cnf.IsAutostart() || cnf.StartDelay != 3 || !(&config.ProcessConfig{}).IsAutostart() {
+		t.Fatal("bad autostart flags")
+	}
+
+	s := newTestSupervisord()
+	s.processMap["manual"] = NewProcess(cnf.FillDefaults(), func(bool) {})
+	defer s.processMap["manual"].Shutdown(true)
+	delayed := NewProcess((&config.ProcessConfig{Name: "delayed", Command: "/bin/true", Stdout: []string{"/dev/null"}}).FillDefaults(), func(bool) {})
+	s.processMap["delayed"] = delayed
+	defer delayed.Shutdown(true)
+	s.processDone.Store("delayed", struct{}{})
+	if !s.IsAllProcessDone(context.Background()) {
+		t.Fatal("process with autostart off should not be accounted")
+	}
+
+	/* pending delayed start is canceled by stop */
+	delayed.StartDelayed(100 * time.Millisecond)
+	delayed.Stop(false)
+	time.Sleep(300 * time.Millisecond)
+	if st := delayed.GetState().State; st != WaitSchedule {
+		t.Fatalf("canceled delayed start should not run, got %v", st)
+	}
+}
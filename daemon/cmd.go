@@ -1,8 +1,13 @@
 package daemon
 
 import (
+	"errors"
+	"fmt"
 	"runtime/debug"
 	"sync"
+	"syscall"
+
+	"github.com/qjpcpu/supervisord/signals"
 )
 
 func newStartCmd() *cmdStart {
@@ -26,8 +31,33 @@ type cmdStop struct {
 	stopImediately bool
 }
 
-func (p *Process) sendCmd(cmd interface{}) {
-	p.cmdQueue <- cmd
+type cmdPause struct {
+	errCh  chan error
+	resume bool
+}
+
+func newPauseCmd(resume bool) *cmdPause {
+	return &cmdPause{errCh: make(chan error, 1), resume: resume}
+}
+
+/* restart or reload process on watched file change */
+type cmdRestart struct {
+	reason string
+}
+
+var errProcessShutdown = errors.New("process is shut down")
+
+// sendCmd queues cmd for command loop, it fails once process is shut down since nobody handles it
+func (p *Process) sendCmd(cmd interface{}) error {
+	if p.shutdown.IsStopped() {
+		return errProcessShutdown
+	}
+	select {
+	case p.cmdQueue <- cmd:
+		return nil
+	case <-p.shutdown.C():
+		return errProcessShutdown
+	}
 }
 
 func (p *Process) processCommand() {
@@ -55,11 +85,15 @@ func (p *Process) onCommand(cmd interface{}) {
 		p.onStartCommand(msg)
 	case *cmdStop:
 		p.onStopCommand(msg)
+	case *cmdPause:
+		p.onPauseCommand(msg)
+	case *cmdRestart:
+		p.onRestartCommand(msg)
 	}
 }
 
 func (p *Process) onStartCommand(cmd *cmdStart) {
-	if p.state == Running || p.state == Starting {
+	if p.currentState().Active() {
 		logger.Log("process %v is already running", p.config.Name)
 		cmd.SendResult(nil)
 		return
@@ -74,12 +108,15 @@ func (p *Process) onStopCommand(cmd *cmdStop) {
 	defer func() {
 		cmd.done <- struct{}{}
 	}()
-	if p.state == WaitSchedule {
+	state := p.currentState()
+	if state == WaitSchedule {
 		logger.Log("process %v is not started", p.config.Name)
 		return
 	}
-	if p.state == Stopped {
+	if state == Stopped {
 		logger.Log("process %v is already stopped", p.config.Name)
+		/* orphans may outlive an exited process */
+		p.stopTree(p.stopSequence(cmd.stopImediately))
 		return
 	}
 	wg := new(sync.WaitGroup)
@@ -94,3 +131,56 @@ func (p *Process) onStopCommand(cmd *cmdStop) {
 	}()
 	wg.Wait()
 }
+
+func (p *Process) onPauseCommand(cmd *cmdPause) {
+	if cmd.resume {
+		if p.currentState() != Paused {
+			cmd.errCh <- fmt.Errorf("process %s is not paused", p.config.Name)
+			return
+		}
+		cmd.errCh <- p.resume()
+		return
+	}
+	proc := p.command()
+	if p.currentState() != Running || proc == nil || proc.Process == nil {
+		cmd.errCh <- fmt.Errorf("process %s is not running", p.config.Name)
+		return
+	}
+	n := p.sdNotifier()
+	if n != nil {
+		n.suspend(true)
+	}
+	if err := signals.Kill(proc.Process, syscall.SIGSTOP, true); err != nil {
+		if n != nil {
+			n.suspend(false)
+		}
+		cmd.errCh <- err
+		return
+	}
+	logger.Log("process %s paused", p.config.Name)
+	p.setState(Paused)
+	p.emit(EventPaused, "")
+	cmd.errCh <- nil
+}
+
+func (p *Process) onRestartCommand(cmd *cmdRestart) {
+	if !p.currentState().Active() {
+		logger.Log("process %s is not running, ignore %s", p.config.Name, cmd.reason)
+		return
+	}
+	if p.config.ReloadSignal != "" {
+		if _, err := p.sendReloadSignal(); err != nil {
+			logger.Log("reload process %s on %s fail %v", p.config.Name, cmd.reason, err)
+		}
+		return
+	}
+	logger.Log("restart process %s on %s", p.config.Name, cmd.reason)
+	/* process is started again at once, it is not done */
+	p.restarting.Store(p.isRunning())
+	p.onStopCommand(newStopCmd(false))
+	start := newStartCmd()
+	p.onStartCommand(start)
+	if err := <-start.errCh; err != nil {
+		logger.Log("restart process %s fail %v", p.config.Name, err)
+	}
+}
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC)
+	cases := map[string]time.Time{
+		"*/5 * * * *":       time.Date(2024, 1, 31, 10, 10, 0, 0, time.UTC),
+		"0 * * * *":         time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC),
+		"30 2 * * *":        time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC),
+		"0 0 29 2 *":        time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 9 * * mon-fri":   time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":         time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * sun":      time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC),
+		"0 0 */2 * 1":       time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC),
+		"15,45 8-9 * jun *": time.Date(2024, 6, 1, 8, 15, 0, 0, time.UTC),
+		"@monthly":          time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"5/20 10 * * *":     time.Date(2024, 1, 31, 10, 25, 0, 0, time.UTC),
+	}
+	for spec, want := range cases {
+		s, err := parseCron(spec)
+		if err != nil {
+			t.Fatalf("parse %s: %v", spec, err)
+		}
+		if got := s.Next(base); !got.Equal(want) {
+			t.Fatalf("%s: next of %v is %v, want %v", spec, base, got, want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+	if s, _ := parseCron("0 0 31 2 *"); !s.Next(base).IsZero() {
+		t.Fatal("impossible schedule should never fire")
+	}
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventStarting       EventType = "STARTING"
+	EventRunning        EventType = "RUNNING"
+	EventBackoff        EventType = "BACKOFF"
+	EventExited         EventType = "EXITED"
+	EventStopped        EventType = "STOPPED"
+	EventFatal          EventType = "FATAL"
+	EventPaused         EventType = "PAUSED"
+	EventResumed        EventType = "RESUMED"
+	EventConfigReloaded EventType = "CONFIG_RELOADED"
+	EventProcessAdded   EventType = "PROCESS_ADDED"
+	EventProcessRemoved EventType = "PROCESS_REMOVED"
+)
+
+// Event is published on process state change and supervisord level changes
+type Event struct {
+	Serial    int64
+	Type      EventType
+	Name      string `json:",omitempty"`
+	PID       int    `json:",omitempty"`
+	ExitCode  int
+	Expected  bool
+	FromState EventType `json:",omitempty"`
+	Message   string    `json:",omitempty"`
+	Time      int64
+}
+
+// EventFilter matches events by process name and event type, empty list matches all
+type EventFilter struct {
+	Names []string
+	Types []string
+}
+
+func (f EventFilter) Match(e *Event) bool {
+	return matchAny(f.Names, e.Name) && matchAny(f.Types, string(e.Type))
+}
+
+func matchAny(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type eventSub struct {
+	ch     chan *Event
+	filter EventFilter
+}
+
+// eventBus fans out events to subscribers, slow subscribers lose events instead of blocking publisher
+type eventBus struct {
+	mu     sync.RWMutex
+	serial int64
+	nextID int64
+	subs   map[int64]*eventSub
+}
+
+var events = newEventBus()
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[int64]*eventSub)}
+}
+
+func (b *eventBus) Publish(e *Event) {
+	e.Serial = atomic.AddInt64(&b.serial, 1)
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns event channel and a cancel function which must be called when done,
+// the channel is closed after cancel
+func (b *eventBus) Subscribe(filter EventFilter, size int) (<-chan *Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	sub := &eventSub{ch: make(chan *Event, size), filter: filter}
+	b.subs[id] = sub
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subs, id)
+			close(sub.ch)
+		})
+	}
+}
+
+func (p *Process) emit(typ EventType, msg string) {
+	p.runMu.Lock()
+	e := &Event{
+		Type:      typ,
+		Name:      p.config.Name,
+		FromState: p.lastEvent,
+		Message:   msg,
+	}
+	p.lastEvent = typ
+	cmd := p.cmd
+	p.runMu.Unlock()
+	if cmd != nil && cmd.Process != nil {
+		e.PID = cmd.Process.Pid
+	}
+	if typ == EventExited && cmd != nil {
+		e.ExitCode = p.waitCode
+		e.Expected = p.exitCodeMatch()
+	}
+	events.Publish(e)
+}
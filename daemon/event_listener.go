@@ -0,0 +1,294 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultListenerBufferSize = 10
+	listenerRetryInterval     = time.Second
+)
+
+/* pool serial is global to all listeners as python supervisor does */
+var listenerSerial int64
+
+// eventListener speaks python supervisor eventlistener protocol with
+// listener process through its stdin and stdout:
+//
+//	listener -> READY\n
+//	supervisord -> ver:3.0 server:supervisor serial:N pool:NAME poolserial:N eventname:NAME len:N\n<payload>
+//	listener -> RESULT 2\nOK
+//
+// undelivered or failed events are kept in a bounded buffer and retried
+type eventListener struct {
+	name    string
+	subs    []string
+	size    int
+	mu      sync.Mutex
+	buffer  []*listenerEvent
+	notify  chan struct{}
+	cancel  func()
+	session *listenerSession
+}
+
+type listenerEvent struct {
+	serial  int64
+	name    string
+	payload string
+}
+
+type listenerSession struct {
+	/* ends used by supervisord */
+	stdin  *os.File
+	stdout *os.File
+	/* ends handed to child */
+	childStdin  *os.File
+	childStdout *os.File
+	stop        chan struct{}
+	once        sync.Once
+}
+
+func newEventListener(name string, subs []string, size int) *eventListener {
+	if len(subs) == 0 {
+		subs = []string{"PROCESS_STATE"}
+	}
+	if size <= 0 {
+		size = defaultListenerBufferSize
+	}
+	l := &eventListener{
+		name:   name,
+		subs:   subs,
+		size:   size,
+		notify: make(chan struct{}, 1),
+	}
+	ch, cancel := events.Subscribe(EventFilter{}, 256)
+	l.cancel = cancel
+	go func() {
+		for e := range ch {
+			l.onEvent(e)
+		}
+	}()
+	return l
+}
+
+func (l *eventListener) Close() {
+	l.cancel()
+}
+
+func (l *eventListener) onEvent(e *Event) {
+	/* never feed listener with its own events */
+	if e.Name == l.name {
+		return
+	}
+	name, payload := listenerEventOf(e)
+	if name == "" || !l.subscribed(name) {
+		return
+	}
+	l.push(&listenerEvent{serial: e.Serial, name: name, payload: payload}, false)
+}
+
+func (l *eventListener) subscribed(name string) bool {
+	for _, sub := range l.subs {
+		sub = strings.ToUpper(strings.TrimSpace(sub))
+		if sub == "EVENT" || sub == name || strings.HasPrefix(name, sub+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *eventListener) push(e *listenerEvent, front bool) {
+	l.mu.Lock()
+	if front {
+		l.buffer = append([]*listenerEvent{e}, l.buffer...)
+	} else {
+		l.buffer = append(l.buffer, e)
+	}
+	if len(l.buffer) > l.size {
+		/* discard oldest event like python supervisor */
+		logger.Log("event listener %s buffer overflow, discard event %s serial %d", l.name, l.buffer[0].name, l.buffer[0].serial)
+		l.buffer = l.buffer[1:]
+	}
+	l.mu.Unlock()
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (l *eventListener) pop(stop chan struct{}) *listenerEvent {
+	for {
+		l.mu.Lock()
+		if len(l.buffer) > 0 {
+			e := l.buffer[0]
+			l.buffer = l.buffer[1:]
+			l.mu.Unlock()
+			return e
+		}
+		l.mu.Unlock()
+		select {
+		case <-l.notify:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// prepare wires listener protocol pipes to command stdin and stdout
+func (l *eventListener) prepare(cmd *exec.Cmd) error {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.session = &listenerSession{
+		stdin:       inW,
+		stdout:      outR,
+		childStdin:  inR,
+		childStdout: outW,
+		stop:        make(chan struct{}),
+	}
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	return nil
+}
+
+// attach starts serving listener after command started
+func (l *eventListener) attach() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sess := l.session; sess != nil {
+		sess.childStdin.Close()
+		sess.childStdout.Close()
+		go l.serve(sess)
+	}
+}
+
+// detach terminates current listener session
+func (l *eventListener) detach() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sess := l.session; sess != nil {
+		l.session = nil
+		sess.once.Do(func() {
+			close(sess.stop)
+			sess.stdin.Close()
+			sess.stdout.Close()
+			sess.childStdin.Close()
+			sess.childStdout.Close()
+		})
+	}
+}
+
+func (l *eventListener) serve(sess *listenerSession) {
+	reader := bufio.NewReader(sess.stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(line) != "READY" {
+			logger.Log("event listener %s protocol error, expect READY got %q", l.name, line)
+			continue
+		}
+		e := l.pop(sess.stop)
+		if e == nil {
+			return
+		}
+		ok, err := l.deliver(sess.stdin, reader, e)
+		if err != nil {
+			/* listener is gone, keep event for next instance */
+			l.push(e, true)
+			return
+		}
+		if !ok {
+			logger.Log("event listener %s rejected event %s serial %d, will retry", l.name, e.name, e.serial)
+			go func() {
+				select {
+				case <-time.After(listenerRetryInterval):
+					l.push(e, true)
+				case <-sess.stop:
+					l.push(e, true)
+				}
+			}()
+		}
+	}
+}
+
+func (l *eventListener) deliver(w io.Writer, r *bufio.Reader, e *listenerEvent) (bool, error) {
+	header := fmt.Sprintf("ver:3.0 server:supervisor serial:%d pool:%s poolserial:%d eventname:%s len:%d\n",
+		e.serial, l.name, atomic.AddInt64(&listenerSerial, 1), e.name, len(e.payload))
+	if _, err := io.WriteString(w, header+e.payload); err != nil {
+		return false, err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != "RESULT" {
+		return false, nil
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 0 {
+		return false, nil
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return false, err
+	}
+	return string(body) == "OK", nil
+}
+
+// listenerEventOf converts event to python supervisor event name and payload
+func listenerEventOf(e *Event) (string, string) {
+	var name string
+	switch e.Type {
+	case EventStarting, EventRunning, EventBackoff, EventExited, EventStopped, EventFatal:
+		name = "PROCESS_STATE_" + string(e.Type)
+	case EventProcessAdded:
+		return "PROCESS_GROUP_ADDED", "groupname:" + e.Name
+	case EventProcessRemoved:
+		return "PROCESS_GROUP_REMOVED", "groupname:" + e.Name
+	default:
+		return "", ""
+	}
+	fromState := e.FromState
+	switch fromState {
+	case "":
+		fromState = EventStopped
+	case EventPaused, EventResumed:
+		/* python supervisor has no paused state */
+		fromState = EventRunning
+	}
+	payload := fmt.Sprintf("processname:%s groupname:%s from_state:%s", e.Name, e.Name, fromState)
+	switch e.Type {
+	case EventExited:
+		expected := 0
+		if e.Expected {
+			expected = 1
+		}
+		payload += fmt.Sprintf(" expected:%d pid:%d", expected, e.PID)
+	case EventRunning, EventStopped:
+		payload += fmt.Sprintf(" pid:%d", e.PID)
+	case EventStarting, EventBackoff:
+		payload += " tries:0"
+	}
+	return name, payload
+}
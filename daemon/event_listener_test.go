@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+/* a listener which rejects the first event and accepts the rest */
+const listenerScript = `
+n=0
+while true; do
+  echo READY
+  read header || exit 0
+  len=${header##*len:}
+  payload=$(head -c $len)
+  n=$((n+1))
+  if [ $n -eq 1 ]; then
+    printf "RESULT 4\nFAIL"
+  else
+    echo "$header|$payload" >> "$OUT"
+    printf "RESULT 2\nOK"
+  fi
+done
+`
+
+func TestEventListener(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "events.txt")
+	cnf := (&config.ProcessConfig{
+		Name:          "listener",
+		Command:       "/bin/sh",
+		Args:          []string{"-c", listenerScript},
+		ENV:           map[string]string{"OUT": out},
+		Stdout:        []string{"/dev/null"},
+		EventListener: true,
+		Events:        []string{"PROCESS_STATE_EXITED"},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+
+	events.Publish(&Event{Type: EventRunning, Name: "api", PID: 10})
+	events.Publish(&Event{Type: EventExited, Name: "api", PID: 10, ExitCode: 1, FromState: EventRunning})
+
+	var data []byte
+	for i := 0; i < 50; i++ {
+		data, _ = os.ReadFile(out)
+		if len(data) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	text := string(data)
+	if !strings.Contains(text, "eventname:PROCESS_STATE_EXITED") ||
+		!strings.Contains(text, "processname:api groupname:api from_state:RUNNING expected:0 pid:10") {
+		t.Fatalf("unexpected delivery %q", text)
+	}
+	if strings.Contains(text, "PROCESS_STATE_RUNNING") {
+		t.Fatalf("unsubscribed event delivered %q", text)
+	}
+}
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestEventBusFilter(t *testing.T) {
+	bus := newEventBus()
+	ch, cancel := bus.Subscribe(EventFilter{Names: []string{"api"}, Types: []string{"exited", "FATAL"}}, 8)
+	defer cancel()
+
+	bus.Publish(&Event{Type: EventRunning, Name: "api"})
+	bus.Publish(&Event{Type: EventExited, Name: "worker"})
+	bus.Publish(&Event{Type: EventExited, Name: "api", ExitCode: 2})
+	bus.Publish(&Event{Type: EventFatal, Name: "api"})
+
+	for _, expect := range []EventType{EventExited, EventFatal} {
+		select {
+		case e := <-ch:
+			if e.Type != expect || e.Name != "api" || e.Serial == 0 {
+				t.Fatalf("unexpected event %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("lost event %s", expect)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	bus := newEventBus()
+	_, cancel := bus.Subscribe(EventFilter{}, 1)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(&Event{Type: EventRunning})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by slow subscriber")
+	}
+}
+
+func TestCrashLoopFatal(t *testing.T) {
+	ch, cancel := events.Subscribe(EventFilter{Names: []string{"crash"}, Types: []string{string(EventFatal)}}, 8)
+	defer cancel()
+	cnf := (&config.ProcessConfig{
+		Name:         "crash",
+		Command:      "/bin/sh",
+		Args:         []string{"-c", "exit 2"},
+		Stdout:       []string{"/dev/null"},
+		StartRetries: 1,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-ch:
+		if !strings.Contains(e.Message, "give up") {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("crash loop should give up with FATAL")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := p.GetState(); st.State != Stopped || st.Restart != 1 {
+		t.Fatalf("process should be stopped after 1 retry, got %v restart %d", st.State, st.Restart)
+	}
+}
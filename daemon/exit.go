@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+/* time given to stop of killed processes to finish after shutdown deadline, e.g. post_stop hooks */
+var shutdownKillGrace = 2 * time.Second
+
+// ExitCode returns exit code of supervisord after Start returns: 128+signal if stopped by signal, code of
+// the first failed process if exit_when_all_done triggers, 0 otherwise
+func (s *Supervisord) ExitCode() int {
+	s.exitMu.Lock()
+	defer s.exitMu.Unlock()
+	if s.exitCode == nil {
+		return 0
+	}
+	return *s.exitCode
+}
+
+// setExitCode records exit code of supervisord, the first one wins
+func (s *Supervisord) setExitCode(code int) {
+	s.exitMu.Lock()
+	defer s.exitMu.Unlock()
+	if s.exitCode == nil {
+		s.exitCode = &code
+	}
+}
+
+// processFailed records process finished with failure for exit code, only a failed job counts as done
+// for exit_when_all_done, a service which gives up is never done and is started again by reload
+func (s *Supervisord) processFailed(p *Process, code int) {
+	logger.Log("process %s failed with code %d", p.config.Name, code)
+	s.exitMu.Lock()
+	if s.failure == nil {
+		s.failure = &code
+	}
+	s.exitMu.Unlock()
+	if p.isJob() {
+		s.processDone.Store(p.config.Name, code)
+	}
+	s.processExit <- false
+}
+
+// exitAllDone stops supervisord as all processes are done, exit code is the one of first failed process
+func (s *Supervisord) exitAllDone() {
+	code := s.failedCode()
+	logger.Log("all process exited, supervisord would exit too, exit code %d", code)
+	s.setExitCode(code)
+	s.Stop(StopOption{})
+}
+
+// failedCode returns exit code of first failed process, 0 if none failed
+func (s *Supervisord) failedCode() int {
+	s.exitMu.Lock()
+	defer s.exitMu.Unlock()
+	if s.failure == nil {
+		return 0
+	}
+	return *s.failure
+}
+
+// handleSignal applies signal_policy, it reports whether supervisord is stopped
+func (s *Supervisord) handleSignal(sig os.Signal) bool {
+	name := policySignalName(sig)
+	action := config.Provider().GetConfig().SignalAction(name)
+	logger.Log("receive signal %v, %s", sig, action)
+	switch action {
+	case config.SignalReload:
+		/* reload stops processes whose exits are received by signal loop */
+		go func() {
+			if err := s.CheckAndReload(); err != nil {
+				logger.Log("reload config %v", err)
+			}
+		}()
+	case config.SignalForward:
+		if err := s.SignalProcess(context.Background(), "all", name, false); err != nil {
+			logger.Log("forward signal %v %v", sig, err)
+		}
+	case config.SignalStop:
+		if num, ok := sig.(syscall.Signal); ok {
+			s.setExitCode(128 + int(num))
+		}
+		s.Stop(StopOption{})
+		return true
+	}
+	return false
+}
+
+// policySignals returns signals handled by signal_policy
+func policySignals() []os.Signal {
+	var list []os.Signal
+	for _, name := range config.PolicySignals() {
+		if sig, err := signals.ToSignal(name); err == nil {
+			list = append(list, sig)
+		}
+	}
+	return list
+}
+
+func policySignalName(sig os.Signal) string {
+	for _, name := range config.PolicySignals() {
+		if s, err := signals.ToSignal(name); err == nil && s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// shutdownAll stops all processes, those still running after deadline are killed, no limit if deadline is 0.
+// It returns at most shutdownKillGrace after deadline even if stop of some process is not finished
+func (s *Supervisord) shutdownAll(ctx context.Context, stopImediately bool, deadline time.Duration) {
+	if deadline <= 0 || stopImediately {
+		s.stopAll(ctx, stopImediately)
+		return
+	}
+	/* processes are stopped from a snapshot, the goroutine may outlive shutdownAll and the caller's lock */
+	list := make([]*Process, 0, len(s.processMap))
+	for _, p := range s.processMap {
+		list = append(list, p)
+	}
+	s.processMap = make(map[string]*Process)
+	done := make(chan struct{})
+	go func() {
+		for _, p := range list {
+			p.Shutdown(false)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-time.After(deadline):
+	}
+	logger.Log("shutdown deadline %v exceeded, kill all processes", deadline)
+	for _, p := range list {
+		if cmd := p.command(); p.isRunning() && cmd != nil && cmd.Process != nil {
+			signals.Kill(cmd.Process, syscall.SIGKILL, true)
+		}
+		for _, pid := range tree.descendants(p, false) {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(shutdownKillGrace):
+		logger.Log("processes are not stopped %v after kill, give up waiting", shutdownKillGrace)
+	}
+}
@@ -0,0 +1,170 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func newTestSupervisord() *Supervisord {
+	return &Supervisord{
+		processMap:   make(map[string]*Process),
+		processMutex: new(sync.RWMutex),
+		processDone:  new(sync.Map),
+		processExit:  make(chan bool, 1),
+	}
+}
+
+func TestFirstFailedExitCode(t *testing.T) {
+	s := newTestSupervisord()
+	for _, code := range []string{"0", "4", "5"} {
+		cnf := (&config.ProcessConfig{
+			Name:    "job" + code,
+			Command: "/bin/sh",
+			Args:    []string{"-c", "exit " + code},
+			Stdout:  []string{"/dev/null"},
+			Type:    ProcessTypeOneshot,
+		}).FillDefaults()
+		p := s.newProcess(cnf)
+		s.processMap[cnf.Name] = p
+		defer p.Shutdown(true)
+		if err := p.RunNow(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-s.processExit:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("job%s should finish", code)
+		}
+	}
+	if !s.IsAllProcessDone(context.Background()) {
+		t.Fatal("failed jobs should count as done")
+	}
+	if s.failedCode() != 4 {
+		t.Fatal("exit code of first failed process should be kept")
+	}
+	if s.ExitCode() != 0 {
+		t.Fatal("exit code is set only when supervisord exits")
+	}
+}
+
+func TestForwardSignal(t *testing.T) {
+	s := newTestSupervisord()
+	out := filepath.Join(t.TempDir(), "usr1")
+	cnf := (&config.ProcessConfig{
+		Name:    "trap",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `trap "touch $OUT" USR1; while true; do sleep 0.1; done`},
+		ENV:     map[string]string{"OUT": out},
+		Stdout:  []string{"/dev/null"},
+	}).FillDefaults()
+	p := s.newProcess(cnf)
+	s.processMap[cnf.Name] = p
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	if s.handleSignal(syscall.SIGUSR1) {
+		t.Fatal("forwarded signal should not stop supervisord")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(out); err != nil {
+		t.Fatal("USR1 should be forwarded to process")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	s := newTestSupervisord()
+	cnf := (&config.ProcessConfig{
+		Name:         "stubborn",
+		Command:      "/bin/sh",
+		Args:         []string{"-c", `trap "" TERM; while true; do sleep 0.1; done`},
+		Stdout:       []string{"/dev/null"},
+		StopWaitSecs: 10,
+	}).FillDefaults()
+	p := s.newProcess(cnf)
+	s.processMap[cnf.Name] = p
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	pid := p.command().Process.Pid
+	start := time.Now()
+	s.shutdownAll(context.Background(), false, 500*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("shutdown should be done by deadline, took %v", elapsed)
+	}
+	if syscall.Kill(pid, 0) == nil {
+		t.Fatal("process should be killed at deadline")
+	}
+}
+
+func TestFailedServiceNotDone(t *testing.T) {
+	s := newTestSupervisord()
+	cnf := (&config.ProcessConfig{
+		Name:         "crash",
+		Command:      "/bin/sh",
+		Args:         []string{"-c", "exit 3"},
+		Stdout:       []string{"/dev/null"},
+		StartRetries: 1,
+	}).FillDefaults()
+	p := s.newProcess(cnf)
+	s.processMap[cnf.Name] = p
+	defer p.Shutdown(true)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.processExit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crash loop should give up")
+	}
+	if _, ok := s.processDone.Load(cnf.Name); ok {
+		t.Fatal("failed service should not be done")
+	}
+	if s.failedCode() != 3 {
+		t.Fatal("exit code of failed service should be kept")
+	}
+}
+
+func TestShutdownDeadlineBounded(t *testing.T) {
+	shutdownKillGrace = 200 * time.Millisecond
+	defer func() { shutdownKillGrace = 2 * time.Second }()
+	s := newTestSupervisord()
+	/* pre_stop hook is not killed at deadline, stop of process never finishes in time */
+	cnf := (&config.ProcessConfig{
+		Name:            "hooked",
+		Command:         "/bin/sh",
+		Args:            []string{"-c", `while true; do sleep 0.1; done`},
+		Stdout:          []string{"/dev/null"},
+		PreStop:         "sleep 2",
+		HookTimeoutSecs: 2,
+	}).FillDefaults()
+	p := s.newProcess(cnf)
+	s.processMap[cnf.Name] = p
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	start := time.Now()
+	s.shutdownAll(context.Background(), false, 300*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown should return shortly after deadline, took %v", elapsed)
+	}
+	if len(s.processMap) != 0 {
+		t.Fatal("processes should be removed when shutdown returns")
+	}
+	/* stop still running in background must not touch processes of supervisord */
+	s.processMap["late"] = p
+	time.Sleep(3 * time.Second)
+	if len(s.processMap) != 1 {
+		t.Fatal("process map should not be reset after shutdown returns")
+	}
+}
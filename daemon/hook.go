@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/qjpcpu/supervisord/reaper"
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+const (
+	HookPreStart  = "pre_start"
+	HookPostStart = "post_start"
+	HookPreStop   = "pre_stop"
+	HookPostStop  = "post_stop"
+
+	defaultHookTimeoutSecs = 30
+)
+
+// runHook runs a lifecycle hook command by /bin/sh with env, cwd and user of process,
+// hook output goes to process log through writers of the process
+func (p *Process) runHook(kind string, command string) error {
+	if command == "" {
+		return nil
+	}
+	out := p.acquireWriters()
+	if out != nil {
+		defer out.release()
+	}
+	return p.runHookTo(kind, command, out)
+}
+
+// runHookTo runs hook with output to out acquired by caller, output is discarded if out is nil
+func (p *Process) runHookTo(kind string, command string, out *outputWriters) error {
+	if command == "" {
+		return nil
+	}
+	cmd, err := p.newCommand("/bin/sh", "-c", command)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		cmd.Stdout, cmd.Stderr = out.stdout, out.stderr
+	}
+	timeout := time.Duration(firstPositive(p.config.HookTimeoutSecs, defaultHookTimeoutSecs)) * time.Second
+	logger.Log("run %s hook of process %s", kind, p.config.Name)
+	if err := startCommand(cmd); err != nil {
+		return fmt.Errorf("%s hook: %v", kind, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := reaper.WaitCommand(cmd)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		signals.Kill(cmd.Process, syscall.SIGKILL, true)
+		<-done
+		err = fmt.Errorf("timeout after %v", timeout)
+	}
+	if err != nil {
+		logger.Log("%s hook of process %s fail %v", kind, p.config.Name, err)
+		return fmt.Errorf("%s hook: %v", kind, err)
+	}
+	return nil
+}
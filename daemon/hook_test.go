@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestHookOutputToProcessLog(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	cnf := (&config.ProcessConfig{
+		Name:      "hooked",
+		Command:   "/bin/sh",
+		Args:      []string{"-c", "echo main; exec sleep 10"},
+		Stdout:    []string{log},
+		PreStart:  "echo pre_start",
+		PostStart: "echo post_start",
+		PreStop:   "echo pre_stop",
+		PostStop:  "echo post_stop",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	p.Shutdown(false)
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"pre_start", "main", "post_start", "pre_stop", "post_stop"} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Fatalf("%s should be in process log, got %q", line, data)
+		}
+	}
+}
+
+func TestPreStartFailAbortsStart(t *testing.T) {
+	for hook, timeout := range map[string]int{"exit 3": 0, "sleep 5": 1} {
+		started := filepath.Join(t.TempDir(), "started")
+		cnf := (&config.ProcessConfig{
+			Name:            "guarded",
+			Command:         "/bin/sh",
+			Args:            []string{"-c", `touch "$OUT"; exec sleep 10`},
+			ENV:             map[string]string{"OUT": started},
+			Stdout:          []string{"/dev/null"},
+			PreStart:        hook,
+			HookTimeoutSecs: timeout,
+		}).FillDefaults()
+		p := NewProcess(cnf, func(bool) {})
+		err := p.Start()
+		if err == nil || !strings.Contains(err.Error(), HookPreStart) {
+			t.Fatalf("pre_start %q should fail start, got %v", hook, err)
+		}
+		if timeout > 0 && !strings.Contains(err.Error(), "timeout") {
+			t.Fatalf("pre_start %q should time out, got %v", hook, err)
+		}
+		time.Sleep(300 * time.Millisecond)
+		p.Shutdown(true)
+		if _, err := os.Stat(started); err == nil {
+			t.Fatalf("program should not start when pre_start %q fails", hook)
+		}
+	}
+}
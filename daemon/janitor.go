@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	chans "github.com/qjpcpu/channel"
+	"github.com/qjpcpu/supervisord/config"
+)
+
+const janitorInterval = time.Minute
+
+type LogFileUsage struct {
+	Path    string
+	Size    int64
+	ModTime int64
+	Active  bool
+}
+
+type LogUsage struct {
+	Quota     int64
+	Used      int64
+	CheckTime int64
+	Files     []LogFileUsage
+	Removed   []string
+}
+
+// logJanitor keeps total size of all managed log files under log_disk_quota,
+// rotated files are removed oldest first, active files are never touched
+type logJanitor struct {
+	mu       sync.Mutex
+	usage    LogUsage
+	stopChan chans.StopChan
+	collect  func() []string
+}
+
+func newLogJanitor(collect func() []string) *logJanitor {
+	return &logJanitor{collect: collect}
+}
+
+func (j *logJanitor) Start() {
+	j.Stop()
+	j.stopChan = chans.NewStopChan()
+	go j.run(j.stopChan)
+}
+
+func (j *logJanitor) Stop() {
+	if j.stopChan != nil {
+		j.stopChan.Stop()
+	}
+}
+
+// Usage returns usage of last check, log files are scanned without enforcing quota if never checked
+func (j *logJanitor) Usage() LogUsage {
+	j.mu.Lock()
+	usage := j.usage
+	j.mu.Unlock()
+	if usage.CheckTime == 0 {
+		files, used := j.scan()
+		usage = LogUsage{
+			Quota:     parseSize(config.Provider().GetConfig().LogDiskQuota),
+			Used:      used,
+			CheckTime: time.Now().Unix(),
+			Files:     files,
+		}
+	}
+	return usage
+}
+
+func (j *logJanitor) run(stopChan chans.StopChan) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	j.Check()
+	for {
+		select {
+		case <-ticker.C:
+			j.Check()
+		case <-stopChan.C():
+			return
+		}
+	}
+}
+
+// Check scans all log files and enforce quota if configured
+func (j *logJanitor) Check() {
+	quota := parseSize(config.Provider().GetConfig().LogDiskQuota)
+	files, used := j.scan()
+	var removed []string
+	if quota > 0 && used > quota {
+		/* oldest rotated files first */
+		candidates := make([]LogFileUsage, 0, len(files))
+		for _, f := range files {
+			if !f.Active {
+				candidates = append(candidates, f)
+			}
+		}
+		sort.SliceStable(candidates, func(i, k int) bool {
+			return candidates[i].ModTime < candidates[k].ModTime
+		})
+		for _, f := range candidates {
+			if used <= quota {
+				break
+			}
+			if err := os.Remove(f.Path); err != nil {
+				logger.Log("[log-quota] remove %s fail %v", f.Path, err)
+				continue
+			}
+			used -= f.Size
+			removed = append(removed, f.Path)
+		}
+		if len(removed) > 0 {
+			logger.Log("[log-quota] removed %d files to keep log usage under %d bytes", len(removed), quota)
+			/* active files keep growing meanwhile */
+			files, used = j.scan()
+		}
+		if used > quota {
+			logger.Log("[log-quota] log usage %d bytes still exceeds quota %d bytes", used, quota)
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.usage = LogUsage{
+		Quota:     quota,
+		Used:      used,
+		CheckTime: time.Now().Unix(),
+		Files:     files,
+		Removed:   removed,
+	}
+}
+
+func (j *logJanitor) scan() (files []LogFileUsage, used int64) {
+	files = scanLogFiles(j.collect())
+	for _, f := range files {
+		used += f.Size
+	}
+	return
+}
+
+// scanLogFiles expands log patterns into regular files, i.e. log files and their rotations. Directories
+// and symlinks are never followed, a file is active if it's the target of a log shortcut or the log path itself
+func scanLogFiles(patterns []string) []LogFileUsage {
+	active := make(map[string]bool)
+	seen := make(map[string]bool)
+	var files []LogFileUsage
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			path := filepath.Clean(match)
+			info, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				if to, err := os.Readlink(path); err == nil {
+					if !filepath.IsAbs(to) {
+						to = filepath.Join(filepath.Dir(path), to)
+					}
+					active[filepath.Clean(to)] = true
+				}
+			case info.Mode().IsRegular() && !seen[path]:
+				seen[path] = true
+				files = append(files, LogFileUsage{Path: path, Size: info.Size(), ModTime: info.ModTime().Unix()})
+			}
+		}
+		/* log path without rotation is always in use */
+		active[filepath.Clean(strings.TrimRight(pattern, "*"))] = true
+	}
+	for i := range files {
+		files[i].Active = active[files[i].Path]
+	}
+	return files
+}
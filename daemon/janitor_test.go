@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestLogJanitorQuota(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "app.log")
+	now := time.Now()
+	for i, name := range []string{"app.log.2024-01-01.01", "app.log.2024-01-01.02", "app.log.2024-01-01.03"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, make([]byte, 1024), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tm := now.Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(file, tm, tm)
+	}
+	os.Symlink("app.log.2024-01-01.03", base)
+
+	cnf := config.Provider().GetConfig()
+	old := cnf.LogDiskQuota
+	defer func() { cnf.LogDiskQuota = old }()
+	cnf.LogDiskQuota = "1K"
+
+	j := newLogJanitor(func() []string { return []string{base + "*"} })
+	j.Check()
+	usage := j.Usage()
+	if usage.Used != 1024 || len(usage.Removed) != 2 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.log.2024-01-01.03")); err != nil {
+		t.Fatalf("active log file removed: %v", err)
+	}
+	if len(usage.Files) != 1 || !usage.Files[0].Active {
+		t.Fatalf("unexpected files %+v", usage.Files)
+	}
+}
+
+func TestLogJanitorOnlyLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "app.log")
+	os.WriteFile(base+".2024-01-01.01", make([]byte, 1024), 0644)
+	os.WriteFile(filepath.Join(dir, "data.db"), make([]byte, 4096), 0644)
+	os.MkdirAll(base+".d", 0755)
+	os.WriteFile(filepath.Join(base+".d", "keep"), make([]byte, 4096), 0644)
+
+	cnf := config.Provider().GetConfig()
+	old := cnf.LogDiskQuota
+	defer func() { cnf.LogDiskQuota = old }()
+	cnf.LogDiskQuota = "1"
+
+	j := newLogJanitor(func() []string { return []string{base + "*"} })
+	if usage := j.Usage(); usage.Used != 1024 || len(usage.Removed) != 0 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if _, err := os.Stat(base + ".2024-01-01.01"); err != nil {
+		t.Fatal("usage should never remove files")
+	}
+	j.Check()
+	if usage := j.Usage(); usage.Used != 0 || len(usage.Removed) != 1 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	for _, file := range []string{filepath.Join(dir, "data.db"), filepath.Join(base+".d", "keep")} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("%s is not a log file and must be kept", file)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+const redactedText = "******"
+
+// lineProcessor is the per line stage between child pipes and sinks
+type lineProcessor struct {
+	w          io.Writer
+	timestamp  bool
+	maxLine    int
+	rateLimit  int
+	redactions []*regexp.Regexp
+	/* rate limit window */
+	window  int64
+	count   int
+	dropped int
+}
+
+// newLineWriter wraps w with per line processing configured by process,
+// nil is returned if no line option is set so output is passed through untouched
+func newLineWriter(w io.Writer, c *config.ProcessConfig) (io.WriteCloser, error) {
+	if !c.LogTimestamp && c.LogMaxLine <= 0 && c.LogRateLimit <= 0 && len(c.LogRedact) == 0 {
+		return nil, nil
+	}
+	lp := &lineProcessor{
+		w:         w,
+		timestamp: c.LogTimestamp,
+		maxLine:   c.LogMaxLine,
+		rateLimit: c.LogRateLimit,
+	}
+	for _, expr := range c.LogRedact {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("bad log_redact %s: %v", expr, err)
+		}
+		lp.redactions = append(lp.redactions, re)
+	}
+	lb := newLineBuffer(lp)
+	lb.limit = c.LogMaxLine
+	return lb, nil
+}
+
+func (lp *lineProcessor) WriteLine(line []byte) error {
+	return lp.WriteTruncated(line, 0)
+}
+
+// WriteTruncated writes a line whose skipped trailing bytes were already dropped by lineBuffer
+func (lp *lineProcessor) WriteTruncated(line []byte, skipped int) error {
+	now := time.Now()
+	if lp.rateLimit > 0 {
+		if sec := now.Unix(); sec != lp.window {
+			lp.window, lp.count = sec, 0
+			lp.writeDropped(now)
+		}
+		if lp.count >= lp.rateLimit {
+			lp.dropped++
+			return nil
+		}
+		lp.count++
+	}
+	for _, re := range lp.redactions {
+		line = re.ReplaceAll(line, []byte(redactedText))
+	}
+	var suffix string
+	if size := len(line) + skipped; lp.maxLine > 0 && size > lp.maxLine {
+		if len(line) > lp.maxLine {
+			line = line[:lp.maxLine]
+		}
+		suffix = fmt.Sprintf(" ...[truncated %d bytes]", size-len(line))
+	}
+	_, err := lp.w.Write(lp.format(now, string(line)+suffix))
+	return err
+}
+
+func (lp *lineProcessor) Close() error {
+	lp.writeDropped(time.Now())
+	return nil
+}
+
+func (lp *lineProcessor) writeDropped(now time.Time) {
+	if lp.dropped > 0 {
+		lp.w.Write(lp.format(now, fmt.Sprintf("[supervisord] %d lines dropped", lp.dropped)))
+		lp.dropped = 0
+	}
+}
+
+func (lp *lineProcessor) format(now time.Time, line string) []byte {
+	if lp.timestamp {
+		return []byte(fmt.Sprintf("[%s] %s\n", now.Format(`2006-01-02 15:04:05`), line))
+	}
+	return []byte(line + "\n")
+}
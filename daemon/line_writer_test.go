@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestLineWriterPassThrough(t *testing.T) {
+	w, err := newLineWriter(new(bytes.Buffer), &config.ProcessConfig{})
+	if err != nil || w != nil {
+		t.Fatalf("expect no line stage, got %v %v", w, err)
+	}
+}
+
+func TestLineWriterTruncateAndRedact(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := newLineWriter(buf, &config.ProcessConfig{
+		LogMaxLine: 10,
+		LogRedact:  []string{`password=\S+`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("short\n0123456789abcdef\npass"))
+	w.Write([]byte("word=secret\n"))
+	w.Write([]byte(strings.Repeat("x", 30)))
+	w.Write([]byte("yyy\ntail"))
+	w.Write([]byte(strings.Repeat("z", 12)))
+	w.Write([]byte(strings.Repeat("z", 12)))
+	w.Close()
+
+	expect := []string{
+		"short",
+		"0123456789 ...[truncated 6 bytes]",
+		"******",
+		"xxxxxxxxxx ...[truncated 23 bytes]",
+		"tailzzzzzz ...[truncated 18 bytes]",
+	}
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); strings.Join(got, "|") != strings.Join(expect, "|") {
+		t.Fatalf("expect %q got %q", expect, got)
+	}
+}
+
+func TestLineWriterRateLimitAndTimestamp(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := newLineWriter(buf, &config.ProcessConfig{
+		LogRateLimit: 2,
+		LogTimestamp: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("a\nb\nc\nd\ne\n"))
+	w.Close()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	stamp := regexp.MustCompile(`^\[\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\] `)
+	var plain []string
+	for _, line := range lines {
+		if !stamp.MatchString(line) {
+			t.Fatalf("line %q has no timestamp", line)
+		}
+		plain = append(plain, stamp.ReplaceAllString(line, ""))
+	}
+	/* lines may span two seconds, but never more than 2 lines per second pass */
+	if n := len(plain); n < 3 || n > 5 || plain[0] != "a" || plain[1] != "b" {
+		t.Fatalf("unexpected output %q", plain)
+	}
+	if !strings.Contains(buf.String(), "lines dropped") {
+		t.Fatalf("expect dropped marker in %q", plain)
+	}
+}
+
+func TestBadRedactRejected(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:      "leak",
+		Command:   "/bin/echo",
+		Stdout:    []string{"/dev/null"},
+		LogRedact: []string{`password=(\S+`},
+	}).FillDefaults()
+	if err := (&config.SupervisorConfig{Process: []*config.ProcessConfig{cnf}}).Validate(); err == nil {
+		t.Fatal("bad log_redact should be rejected by config")
+	}
+	p := &Process{config: cnf}
+	if _, err := p.createCommand(); err == nil {
+		t.Fatal("process must not start with raw output")
+	}
+}
@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultNotifyTimeoutSecs = 90
+
+// sdNotifier receives sd_notify messages of one process instance on NOTIFY_SOCKET
+type sdNotifier struct {
+	name      string
+	addr      string
+	conn      *net.UnixConn
+	ready     chan struct{}
+	readyOnce sync.Once
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	status   string
+	mainPID  int
+	lastPing time.Time
+	paused   bool /* stopped process can not ping, watchdog is suspended */
+}
+
+// newSdNotifier listens on an abstract unix datagram socket, abstract sockets need no file
+// cleanup and are writable by processes running as another user
+func newSdNotifier(name string) (*sdNotifier, error) {
+	addr := fmt.Sprintf("@supervisord/%d/%s/%d", os.Getpid(), name, time.Now().UnixNano())
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	n := &sdNotifier{
+		name:     name,
+		addr:     addr,
+		conn:     conn,
+		ready:    make(chan struct{}),
+		closed:   make(chan struct{}),
+		lastPing: time.Now(),
+	}
+	go n.receive()
+	return n, nil
+}
+
+func (n *sdNotifier) receive() {
+	buf := make([]byte, 4096)
+	for {
+		size, _, err := n.conn.ReadFromUnix(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(buf[:size]), "\n") {
+			n.handle(line)
+		}
+	}
+}
+
+func (n *sdNotifier) handle(line string) {
+	key, val, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch key {
+	case "READY":
+		if val == "1" {
+			n.readyOnce.Do(func() { close(n.ready) })
+		}
+	case "STATUS":
+		n.status = val
+	case "WATCHDOG":
+		if val == "1" {
+			n.lastPing = time.Now()
+		} else if val == "trigger" {
+			n.lastPing = time.Time{}
+		}
+	case "MAINPID":
+		if pid, err := strconv.Atoi(val); err == nil {
+			logger.Log("process %s reports main pid %d", n.name, pid)
+			n.mainPID = pid
+		}
+	case "STOPPING":
+		if val == "1" {
+			logger.Log("process %s is stopping", n.name)
+			n.status = "stopping"
+		}
+	}
+}
+
+func (n *sdNotifier) Status() (string, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.status, n.mainPID
+}
+
+// prepare sets NOTIFY_SOCKET and WATCHDOG_USEC of cmd
+func (n *sdNotifier) prepare(cmd *exec.Cmd, watchdog time.Duration) {
+	cmd.Env = append(cmd.Env, "NOTIFY_SOCKET="+n.addr)
+	if watchdog > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("WATCHDOG_USEC=%d", watchdog.Microseconds()))
+	}
+}
+
+// waitReady waits READY=1, it returns false when timeout or exited is closed first
+func (n *sdNotifier) waitReady(timeout time.Duration, exited <-chan struct{}) bool {
+	select {
+	case <-n.ready:
+		return true
+	case <-exited:
+	case <-time.After(timeout):
+	}
+	return false
+}
+
+// suspend suspends watchdog while process is paused, it counts again from now once unpaused
+func (n *sdNotifier) suspend(paused bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.paused = paused
+	n.lastPing = time.Now()
+}
+
+// watch calls onMiss once if no WATCHDOG=1 is received within watchdog interval
+func (n *sdNotifier) watch(watchdog time.Duration, onMiss func()) {
+	n.mu.Lock()
+	n.lastPing = time.Now()
+	n.mu.Unlock()
+	ticker := time.NewTicker(watchdog / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.closed:
+			return
+		case <-ticker.C:
+			n.mu.Lock()
+			missed := !n.paused && time.Since(n.lastPing) > watchdog
+			n.mu.Unlock()
+			if missed {
+				onMiss()
+				return
+			}
+		}
+	}
+}
+
+func (n *sdNotifier) Close() {
+	n.closeOnce.Do(func() {
+		close(n.closed)
+		n.conn.Close()
+	})
+}
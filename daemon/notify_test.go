@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func sdNotify(t *testing.T, addr string, msg string) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:         "notified",
+		Command:      "/bin/sleep",
+		Args:         []string{"100"},
+		Stdout:       []string{"/dev/null"},
+		Notify:       true,
+		WatchdogSecs: 1,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	/* start returns while process is starting, READY=1 is waited in background */
+	begin := time.Now()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Fatalf("start should not wait READY=1, took %v", elapsed)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if st := p.GetState().State; st != Starting {
+		t.Fatalf("process should be starting before READY=1, got %v", st)
+	}
+	sdNotify(t, p.sdNotifier().addr, "READY=1\nSTATUS=warmed up\nMAINPID=42")
+	time.Sleep(300 * time.Millisecond)
+	if st := p.GetState(); st.State != Running || st.Status != "warmed up" || st.MainPID != 42 {
+		t.Fatalf("bad state %+v", st)
+	}
+
+	/* watchdog keeps process alive while pinged */
+	for i := 0; i < 4; i++ {
+		sdNotify(t, p.sdNotifier().addr, "WATCHDOG=1")
+		time.Sleep(400 * time.Millisecond)
+	}
+	if p.GetState().Restart != 0 {
+		t.Fatal("pinged process should not be restarted")
+	}
+	/* missed watchdog restarts process */
+	time.Sleep(2 * time.Second)
+	if p.GetState().Restart == 0 {
+		t.Fatal("process should be restarted after watchdog missed")
+	}
+}
+
+func TestWatchdogPaused(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:         "watched",
+		Command:      "/bin/sleep",
+		Args:         []string{"100"},
+		Stdout:       []string{"/dev/null"},
+		WatchdogSecs: 1,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := p.command().Process.Pid
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	/* paused process can not ping, watchdog must not kill it */
+	time.Sleep(2 * time.Second)
+	if err := p.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	sdNotify(t, p.sdNotifier().addr, "WATCHDOG=1")
+	time.Sleep(300 * time.Millisecond)
+	if st := p.GetState(); st.State != Running || st.Restart != 0 || p.command().Process.Pid != pid {
+		t.Fatalf("paused process should resume as is, got %v restart %d", st.State, st.Restart)
+	}
+}
@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestPauseResume(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "ticks")
+	cnf := (&config.ProcessConfig{
+		Name:    "ticker",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `while true; do echo x >> "$OUT"; sleep 0.05; done`},
+		ENV:     map[string]string{"OUT": out},
+		Stdout:  []string{"/dev/null"},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Resume(); err == nil {
+		t.Fatal("resume should fail on stopped process")
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(200 * time.Millisecond)
+
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState().State != Paused || !p.isRunning() {
+		t.Fatalf("bad state %v", p.GetState().State)
+	}
+	time.Sleep(100 * time.Millisecond)
+	before, _ := os.ReadFile(out)
+	time.Sleep(300 * time.Millisecond)
+	after, _ := os.ReadFile(out)
+	if len(before) != len(after) {
+		t.Fatal("paused process is still running")
+	}
+	if err := p.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if resumed, _ := os.ReadFile(out); len(resumed) == len(after) {
+		t.Fatal("process is not resumed")
+	}
+
+	/* stop a paused process by TERM */
+	p.Pause()
+	start := time.Now()
+	p.Stop(false)
+	if p.GetState().State != Stopped || time.Since(start) > 3*time.Second {
+		t.Fatalf("paused process should be stopped gracefully, state %v", p.GetState().State)
+	}
+}
@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	myhttp "github.com/qjpcpu/http"
+	"github.com/qjpcpu/supervisord/reaper"
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+const (
+	defaultHealthCheckTimeoutSecs = 10
+	probeInterval                 = 500 * time.Millisecond
+)
+
+/* process without health_check is healthy once it keeps running this long */
+var healthySettleInterval = time.Second
+
+// probe checks target once, supported targets:
+//
+//	tcp://127.0.0.1:8080        tcp port accepts connection
+//	unix:///run/app.sock        unix socket accepts connection
+//	http://127.0.0.1:8080/ping  http(s) GET returns 2xx
+//	exec:./bin/check.sh         command run by /bin/sh with process env, cwd and user exits 0
+//	file:///run/app/ready       file exists, relative path is relative to process cwd
+func (p *Process) probe(ctx context.Context, target string) error {
+	if command, ok := strings.CutPrefix(target, "exec:"); ok {
+		return p.probeExec(ctx, command)
+	}
+	if file, ok := strings.CutPrefix(target, "file://"); ok {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(p.config.CWD, file)
+		}
+		_, err := os.Stat(file)
+		return err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return probeDial(ctx, "tcp", u.Host)
+	case "unix":
+		return probeDial(ctx, "unix", u.Path)
+	case "http", "https":
+		return myhttp.NewClient().
+			SetTimeout(defaultHealthCheckTimeoutSecs*time.Second).
+			Get(ctx, target).
+			HandleResult(func(res *http.Response) error {
+				io.Copy(io.Discard, res.Body)
+				if res.StatusCode < 200 || res.StatusCode >= 300 {
+					return fmt.Errorf("status %s", res.Status)
+				}
+				return nil
+			})
+	default:
+		return fmt.Errorf("unsupported probe %s", target)
+	}
+}
+
+// waitProbe probes target until success or ctx done
+func (p *Process) waitProbe(ctx context.Context, target string) error {
+	for {
+		err := p.probe(ctx, target)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("probe %s: %v", target, err)
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// waitHealthy waits process running and passing health_check, process without health_check
+// is healthy when it keeps running for a while
+func (p *Process) waitHealthy(ctx context.Context) error {
+	for {
+		if cmd := p.command(); p.GetState().State == Running && cmd != nil && cmd.Process != nil {
+			if p.config.HealthCheck != "" {
+				return p.waitProbe(ctx, p.config.HealthCheck)
+			}
+			pid := cmd.Process.Pid
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("process %s is not healthy: %v", p.config.Name, ctx.Err())
+			case <-time.After(healthySettleInterval):
+			}
+			if cmd := p.command(); p.GetState().State == Running && cmd != nil && cmd.Process != nil && cmd.Process.Pid == pid {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("process %s is not running: %v", p.config.Name, ctx.Err())
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+func probeDial(ctx context.Context, network, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p *Process) probeExec(ctx context.Context, command string) error {
+	cmd, err := p.newCommand("/bin/sh", "-c", command)
+	if err != nil {
+		return err
+	}
+	if err := startCommand(cmd); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := reaper.WaitCommand(cmd)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		signals.Kill(cmd.Process, syscall.SIGKILL, true)
+		<-done
+		return ctx.Err()
+	}
+}
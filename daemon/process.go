@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,9 +12,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/qjpcpu/supervisord/reaper"
 	"github.com/qjpcpu/supervisord/signals"
 
 	"github.com/qjpcpu/filelog"
@@ -34,6 +37,8 @@ const (
 	Starting
 	Running
 	Stopped
+	Paused
+	Waiting
 )
 
 func (s State) String() string {
@@ -46,24 +51,55 @@ func (s State) String() string {
 		return "Stopped"
 	case Running:
 		return "Running"
+	case Paused:
+		return "Paused"
+	case Waiting:
+		return "Waiting"
 	default:
 		return ""
 	}
 }
 
+// Active reports whether process is started and not stopped yet
+func (s State) Active() bool {
+	return s == Starting || s == Running || s == Paused || s == Waiting
+}
+
 type ProcessExitedCb func(byuser bool)
 
 type Process struct {
 	config                          *config.ProcessConfig
 	createTime, startTime, stopTime int64
 	restartCount                    int64
+	crashes                         int /* unexpected exits in a row within crashLoopSecs of start */
 	cmd                             *exec.Cmd
 	state                           State
 	stopFlag                        chans.StopChan
-	writers                         []io.WriteCloser
+	runMu                           sync.RWMutex /* guards run state read by other goroutines: state, times, cmd, waitDone, notifier, exitCode, lastEvent */
+	mu                              sync.Mutex   /* guards writers */
+	writers                         *outputWriters
 	cb                              ProcessExitedCb
 	cmdQueue                        chan interface{}
 	shutdown                        chans.StopChan
+	lastEvent                       EventType
+	stopReason                      string
+	listener                        *eventListener
+	notifier                        *sdNotifier
+	waitDone                        chan struct{}
+	waitErr                         error
+	waitCode                        int            /* exit code of last run, -1 if terminated by signal */
+	failed                          func(code int) /* process failed and is never restarted */
+	cron                            *cronJob
+	cronErr                         error
+	jobQueued                       atomic.Bool
+	delayMu                         sync.Mutex
+	delayed                         *time.Timer
+	exitCode                        *int
+	watcher                         *fileWatcher
+	restarting                      atomic.Bool
+	fifoDir                         string
+	adoption                        *processRecord
+	output                          *fifoOutput
 }
 
 type ProcessState struct {
@@ -72,6 +108,11 @@ type ProcessState struct {
 	CreateTime, StartTime, StopTime int64
 	Config                          config.ProcessConfig
 	PID                             string
+	Status                          string `json:",omitempty"`
+	MainPID                         int    `json:",omitempty"`
+	NextRun                         int64  `json:",omitempty"`
+	ExitCode                        *int   `json:",omitempty"`
+	Orphans                         []int  `json:",omitempty"`
 }
 
 func NewProcess(cnf *config.ProcessConfig, pe ProcessExitedCb) *Process {
@@ -84,11 +125,24 @@ func NewProcess(cnf *config.ProcessConfig, pe ProcessExitedCb) *Process {
 		cmdQueue:   make(chan interface{}, 3),
 		shutdown:   chans.NewStopChan(),
 	}
+	if cnf.EventListener {
+		p.listener = newEventListener(cnf.Name, cnf.Events, cnf.BufferSize)
+	}
+	if cnf.Schedule != "" {
+		if p.cron, p.cronErr = newCronJob(p, cnf.Schedule); p.cronErr != nil {
+			logger.Log("bad schedule of process %s %v", cnf.Name, p.cronErr)
+		}
+	}
+	if len(cnf.Watch) > 0 {
+		p.watchFiles()
+	}
+	tree.add(p)
 	go p.processCommand()
 	return p
 }
 
 func (p *Process) GetState() ProcessState {
+	p.runMu.RLock()
 	stopTm := p.stopTime
 	if stopTm < p.startTime {
 		stopTm = 0
@@ -97,6 +151,21 @@ func (p *Process) GetState() ProcessState {
 	if p.cmd != nil && p.cmd.Process != nil {
 		pid = strconv.FormatInt(int64(p.cmd.Process.Pid), 10)
 	}
+	ps := ProcessState{
+		State:      p.state,
+		Restart:    p.restartCount,
+		CreateTime: p.createTime,
+		StartTime:  p.startTime,
+		StopTime:   stopTm,
+		Config:     *p.config.Clone(),
+		PID:        pid,
+	}
+	if p.exitCode != nil {
+		code := *p.exitCode
+		ps.ExitCode = &code
+	}
+	notifier := p.notifier
+	p.runMu.RUnlock()
 	env := make(map[string]string)
 	fp.KVStreamOf(p.config.ENV).
 		ZipMap(func(k, v string) string {
@@ -111,40 +180,169 @@ func (p *Process) GetState() ProcessState {
 			return arr[0], arr[1]
 		}).
 		To(&env)
-	ps := ProcessState{
-		State:      p.state,
-		Restart:    p.restartCount,
-		CreateTime: p.createTime,
-		StartTime:  p.startTime,
-		StopTime:   stopTm,
-		Config:     *p.config.Clone(),
-		PID:        pid,
+	if notifier != nil {
+		ps.Status, ps.MainPID = notifier.Status()
+	}
+	if p.cron != nil {
+		if next := p.cron.Next(); !next.IsZero() {
+			ps.NextRun = next.Unix()
+		}
 	}
 	ps.Config.ENV = env
+	ps.Orphans = tree.descendants(p, true)
 	return ps
 }
 
+// Start starts process, scheduled process is armed to run on its timetable instead
 func (p *Process) Start() error {
+	if p.cronErr != nil {
+		return p.cronErr
+	}
+	if p.cron != nil {
+		p.cron.Arm()
+		return nil
+	}
+	return p.start()
+}
+
+func (p *Process) start() error {
 	cmd := newStartCmd()
-	p.sendCmd(cmd)
-	return <-cmd.errCh
+	if err := p.sendCmd(cmd); err != nil {
+		return err
+	}
+	/* command loop may exit before handling cmd */
+	select {
+	case err := <-cmd.errCh:
+		return err
+	case <-p.shutdown.C():
+		return errProcessShutdown
+	}
 }
 
+// StartDelayed starts process after d, the pending start is canceled by Stop
+func (p *Process) StartDelayed(d time.Duration) {
+	p.delayMu.Lock()
+	defer p.delayMu.Unlock()
+	logger.Log("process %s will start after %v", p.config.Name, d)
+	p.delayed = time.AfterFunc(d, func() { p.Start() })
+}
+
+// Stop stops process, scheduled process is disarmed too
 func (p *Process) Stop(stopImediately bool) error {
+	p.delayMu.Lock()
+	if p.delayed != nil {
+		p.delayed.Stop()
+		p.delayed = nil
+	}
+	p.delayMu.Unlock()
+	if p.cron != nil {
+		p.cron.Disarm()
+	}
+	return p.stop(stopImediately)
+}
+
+func (p *Process) stop(stopImediately bool) error {
+	p.jobQueued.Store(false)
 	cmd := newStopCmd(stopImediately)
-	p.sendCmd(cmd)
-	<-cmd.done
-	return nil
+	if err := p.sendCmd(cmd); err != nil {
+		return err
+	}
+	select {
+	case <-cmd.done:
+		return nil
+	case <-p.shutdown.C():
+		return errProcessShutdown
+	}
 }
 
 func (p *Process) Shutdown(stopImediately bool) error {
+	if p.watcher != nil {
+		p.watcher.Close()
+	}
 	p.Stop(stopImediately)
+	tree.remove(p)
 	p.shutdown.Stop()
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	return nil
+}
+
+// Pause freezes process group by SIGSTOP
+func (p *Process) Pause() error {
+	return p.sendPause(false)
+}
+
+// Resume continues paused process group by SIGCONT
+func (p *Process) Resume() error {
+	return p.sendPause(true)
+}
+
+func (p *Process) sendPause(resume bool) error {
+	cmd := newPauseCmd(resume)
+	if err := p.sendCmd(cmd); err != nil {
+		return err
+	}
+	select {
+	case err := <-cmd.errCh:
+		return err
+	case <-p.shutdown.C():
+		return errProcessShutdown
+	}
+}
+
+func (p *Process) resume() error {
+	if cmd := p.command(); cmd != nil && cmd.Process != nil {
+		if err := signals.Kill(cmd.Process, syscall.SIGCONT, true); err != nil {
+			return err
+		}
+	}
+	if n := p.sdNotifier(); n != nil {
+		n.suspend(false)
+	}
+	logger.Log("process %s resumed", p.config.Name)
+	p.setState(Running)
+	p.emit(EventResumed, "")
 	return nil
 }
 
 func (p *Process) OmitExitCode() {
+	p.runMu.Lock()
 	p.config.OmitExitCode = true
+	p.runMu.Unlock()
+}
+
+func (p *Process) setState(state State) {
+	p.runMu.Lock()
+	p.state = state
+	p.runMu.Unlock()
+}
+
+// currentState returns state of process, it is safe to call from any goroutine
+func (p *Process) currentState() State {
+	p.runMu.RLock()
+	defer p.runMu.RUnlock()
+	return p.state
+}
+
+// command returns command of current or last run, nil if process never ran
+func (p *Process) command() *exec.Cmd {
+	p.runMu.RLock()
+	defer p.runMu.RUnlock()
+	return p.cmd
+}
+
+// lastRun returns command of current or last run with channel closed once it exits
+func (p *Process) lastRun() (*exec.Cmd, <-chan struct{}) {
+	p.runMu.RLock()
+	defer p.runMu.RUnlock()
+	return p.cmd, p.waitDone
+}
+
+func (p *Process) sdNotifier() *sdNotifier {
+	p.runMu.RLock()
+	defer p.runMu.RUnlock()
+	return p.notifier
 }
 
 func (p *Process) runProcess(startCallback func(error)) {
@@ -155,38 +353,99 @@ func (p *Process) runProcess(startCallback func(error)) {
 	defer runtime.UnlockOSThread()
 
 	callbackOnce := new(sync.Once)
+	var cmd *exec.Cmd
+	var err error
 	if startCallback == nil {
 		startCallback = func(error) {}
 	}
 	logger.Log("starting process %v", p.config.Name)
 	/* reset state and get finalizer */
 	flag, releaseFn := p.runProcessPrepare()
-	defer releaseFn()
+	defer func() {
+		releaseFn()
+		p.onJobExit()
+	}()
+	/* process left running by previous supervisord is monitored only */
+	if rec := p.adoption; rec != nil {
+		p.adoption = nil
+		err := p.runProcessAdopt(rec)
+		callbackOnce.Do(func() { startCallback(err) })
+		if err != nil {
+			p.emit(EventFatal, err.Error())
+			return
+		}
+		p.runProcessUpdateState()
+		goto WAIT
+	}
 ENTRY:
-	/* create command and start */
-	if err := p.runProcessStartCommand(flag); err != nil {
+	/* create command and run pre_start, its failure is returned by start */
+	if cmd, err = p.runProcessCreateCommand(); err != nil {
+		p.releaseProcessResource()
+		p.emit(EventFatal, err.Error())
 		callbackOnce.Do(func() { startCallback(err) })
+		if !flag.IsStopped() {
+			p.fail(1)
+		}
 		return
 	}
-	/* set state to running and write pid file */
-	p.runProcessUpdateState()
-	callbackOnce.Do(func() { startCallback(nil) })
+	/* wait_for conditions, start returns once process is waiting */
+	if len(p.config.WaitFor) > 0 {
+		callbackOnce.Do(func() { startCallback(nil) })
+		if err := p.runProcessWaitFor(flag); err != nil {
+			p.releaseProcessResource()
+			if !flag.IsStopped() {
+				p.emit(EventFatal, err.Error())
+				p.fail(1)
+			}
+			return
+		}
+	}
+	/* start command */
+	if err := p.runProcessStartCommand(flag, cmd); err != nil {
+		p.releaseProcessResource()
+		p.emit(EventFatal, err.Error())
+		callbackOnce.Do(func() { startCallback(err) })
+		if !flag.IsStopped() {
+			p.fail(1)
+		}
+		return
+	}
+	/* notify process stays starting until READY=1, start returns once it is starting as wait_for does */
+	if p.config.Notify {
+		callbackOnce.Do(func() { startCallback(nil) })
+	}
+	if err := p.runProcessWaitReady(); err != nil {
+		logger.Log("process %s %v", p.config.Name, err)
+	} else {
+		/* set state to running and write pid file */
+		p.runProcessUpdateState()
+		p.runHook(HookPostStart, p.config.PostStart)
+		callbackOnce.Do(func() { startCallback(nil) })
+	}
+WAIT:
 	/* wait process exit */
 	p.runProcessWait(flag)
 	/* clear writer and remove pid file */
 	p.releaseProcessResource()
 	/* check exit code */
 	if shouldRestart := p.runProcessCheckResult(flag); shouldRestart {
+		if p.giveUp() {
+			return
+		}
 		interval := p.restartInterval(p.restartCount)
-		p.state = Starting
+		p.setState(Starting)
 		logger.Log("will restart after %v, total restart count %v", interval, p.restartCount+1)
+		p.emit(EventBackoff, fmt.Sprintf("restart after %v", interval))
 		select {
 		case <-time.After(interval):
 		case <-flag.C():
 			return
 		}
+		p.runMu.Lock()
 		p.restartCount++
 		p.startTime = time.Now().Unix()
+		p.runMu.Unlock()
+		p.emit(EventStarting, "")
 		goto ENTRY
 	}
 }
@@ -197,100 +456,97 @@ func (p *Process) stopProcess(stopImediately bool) {
 }
 
 func (p *Process) _stopProcess(stopImediately bool) {
-	sig := p.config.StopSignal
-	if stopImediately {
-		sig = config.DefaultKillSignal
-	} else if sig == "" {
-		sig = config.DefaultStopSignal
-	}
-	ossig, err := signals.ToSignal(sig)
-	if err != nil {
-		logger.Log("parse signal fail %v", err.Error())
-		ossig = syscall.SIGTERM
+	/* a stopped process can not handle signals except KILL */
+	if p.currentState() == Paused {
+		p.resume()
 	}
-	if p.cmd != nil && p.cmd.Process != nil {
-		logger.Log("send signal %s to process %s", sig, p.config.Name)
-		signals.Kill(p.cmd.Process, ossig, true)
-	}
-	/* wait */
-	waitSec := firstPositive(p.config.StopWaitSecs, config.DefaultStopWaitSecs) * 1000
-	interval := 100
-	for i := 0; i < int(waitSec/interval); i++ {
-		if !p.isRunning() {
-			logger.Log("process %s is halt after send %s %s later", p.config.Name, sig, time.Millisecond*time.Duration(interval*i))
-			return
-		}
-		time.Sleep(time.Millisecond * time.Duration(interval))
+	/* post_stop writes to process log even if the run is over meanwhile */
+	out := p.acquireWriters()
+	if out != nil {
+		defer out.release()
 	}
-	if p.cmd != nil && p.cmd.Process != nil {
-		logger.Log("send signal %s to process %s", `KILL`, p.config.Name)
-		signals.Kill(p.cmd.Process, syscall.SIGKILL, true)
+	if !stopImediately && p.isRunning() {
+		p.runHookTo(HookPreStop, p.config.PreStop, out)
 	}
+	defer p.runHookTo(HookPostStop, p.config.PostStop, out)
+	/* descendants must be attributed before their parent is gone */
+	tree.scan()
+	steps := p.stopSequence(stopImediately)
+	p.runStopSequence(steps)
+	p.stopTree(steps)
 }
 
 func (p *Process) releaseProcessResource() {
-	for _, w := range p.writers {
-		w.Close()
+	if p.output != nil {
+		p.output.Close()
+		p.output = nil
+	}
+	p.setWriters(nil)
+	if p.listener != nil {
+		p.listener.detach()
+	}
+	if n := p.sdNotifier(); n != nil {
+		n.Close()
 	}
-	p.writers = nil
 	if p.config.PidFile != "" {
 		os.Remove(p.config.PidFile)
 	}
 }
 
 func (p *Process) isRunning() bool {
-	if p.cmd != nil && p.cmd.Process != nil {
+	if cmd := p.command(); cmd != nil && cmd.Process != nil {
 		if runtime.GOOS == "windows" {
-			proc, err := os.FindProcess(p.cmd.Process.Pid)
+			proc, err := os.FindProcess(cmd.Process.Pid)
 			return proc != nil && err == nil
 		}
-		return signals.Kill(p.cmd.Process, syscall.Signal(0), true) == nil
+		return signals.Kill(cmd.Process, syscall.Signal(0), true) == nil
 	}
 	return false
 }
 
-func (p *Process) createCommand() error {
-	cmd := exec.Command(p.config.Command, p.config.Args...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid:   true,
-		Pdeathsig: syscall.SIGKILL,
+// createCommand creates command of next run, it becomes p.cmd once started
+func (p *Process) createCommand() (*exec.Cmd, error) {
+	cmd, err := p.newCommand(p.config.Command, p.config.Args...)
+	if err != nil {
+		return nil, err
 	}
-	cmd.Env = fp.KVStreamOf(p.config.ENV).
-		ZipMap(func(k, v string) string {
-			return fmt.Sprintf(`%s=%s`, k, v)
-		}).
-		Union(fp.StreamOf(os.Environ())).
-		UniqBy(func(pair string) string {
-			return strings.Split(pair, "=")[0]
-		}).
-		Strings()
-	cmd.Dir = p.config.CWD
-	if p.config.SysUser != "" {
-		u, err := user.Lookup(p.config.SysUser)
-		if err != nil {
-			return err
-		}
-		uid, err := strconv.ParseUint(u.Uid, 10, 32)
-		if err != nil {
-			return err
+	if err := p.attachSockets(cmd); err != nil {
+		return nil, err
+	}
+	stdout, stderr, closers, err := p.createWriters()
+	if err != nil {
+		return nil, err
+	}
+	out := newOutputWriters(stdout, stderr, closers)
+	p.setWriters(out)
+	cmd.Stdout, cmd.Stderr = out.stdout, out.stderr
+	if p.fifoDir != "" {
+		if err := p.attachFifoOutput(cmd); err != nil {
+			return nil, err
 		}
-		gid, err := strconv.ParseUint(u.Gid, 10, 32)
-		if err != nil && p.config.SysGroup == "" {
-			return err
+	}
+	var notifier *sdNotifier
+	if p.config.Notify || p.config.WatchdogSecs > 0 {
+		if notifier, err = newSdNotifier(p.config.Name); err != nil {
+			return nil, err
 		}
-		if p.config.SysGroup != "" {
-			g, err := user.LookupGroup(p.config.SysGroup)
-			if err != nil {
-				return err
-			}
-			gid, err = strconv.ParseUint(g.Gid, 10, 32)
-			if err != nil {
-				return err
-			}
+		notifier.prepare(cmd, time.Duration(p.config.WatchdogSecs)*time.Second)
+	}
+	p.runMu.Lock()
+	p.notifier = notifier
+	p.runMu.Unlock()
+	if p.listener != nil {
+		/* stdout of event listener is protocol channel */
+		if err := p.listener.prepare(cmd); err != nil {
+			return nil, err
 		}
-		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), NoSetGroups: true}
 	}
-	/* writer */
+	return cmd, nil
+}
+
+// createWriters opens stdout and stderr writers of process, closers must be closed after use.
+// It fails if line stage can not be created, raw output must never bypass redaction
+func (p *Process) createWriters() (stdout io.Writer, stderr io.Writer, closers []io.WriteCloser, err error) {
 	writers := make(map[string]io.WriteCloser)
 	fp.StreamOf(p.config.Stderr).
 		Union(fp.StreamOf(p.config.Stdout)).
@@ -304,6 +560,14 @@ func (p *Process) createCommand() error {
 			case `/dev/stderr`:
 				return w, writeCloser(os.Stdout)
 			default:
+				if isURLSink(w) {
+					if writer, err := newSinkWriter(w, p.config.Name); err != nil {
+						logger.Log("create sink %s fail %v", w, err)
+					} else {
+						return w, writer
+					}
+					return w, writeCloser(io.Discard)
+				}
 				/* file logger */
 				os.MkdirAll(filepath.Dir(w), 0755)
 				keepCount := 24
@@ -332,13 +596,160 @@ func (p *Process) createCommand() error {
 			ToSlice(&ws)
 		return io.MultiWriter(ws...)
 	}
-	cmd.Stdout = getWriters(p.config.Stdout)
-	cmd.Stderr = getWriters(p.config.Stderr)
-	p.cmd = cmd
-	fp.KVStreamOf(writers).Values().ToSlice(&p.writers)
+	var stages []io.WriteCloser
+	withStage := func(w io.Writer) io.Writer {
+		stage, e := newLineWriter(w, p.config)
+		if e != nil {
+			err = e
+		}
+		if stage == nil {
+			return w
+		}
+		stages = append(stages, stage)
+		return stage
+	}
+	stdout = withStage(getWriters(p.config.Stdout))
+	stderr = withStage(getWriters(p.config.Stderr))
+	/* line stages go first so they are flushed before sinks get closed */
+	closers = stages
+	fp.KVStreamOf(writers).Values().Foreach(func(w io.WriteCloser) {
+		closers = append(closers, w)
+	}).Run()
+	if err != nil {
+		logger.Log("create line writer of process %s fail %v", p.config.Name, err)
+		for _, w := range closers {
+			w.Close()
+		}
+		return nil, nil, nil, err
+	}
+	return
+}
+
+// setWriters replaces output writers of current run, the old ones are closed once hooks release them
+func (p *Process) setWriters(out *outputWriters) {
+	p.mu.Lock()
+	old := p.writers
+	p.writers = out
+	p.mu.Unlock()
+	if old != nil {
+		old.release()
+	}
+}
+
+// acquireWriters returns output writers of current run for hooks, nil if process has none.
+// They must be released after use
+func (p *Process) acquireWriters() *outputWriters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.writers != nil && p.writers.acquire() {
+		return p.writers
+	}
 	return nil
 }
 
+// outputWriters are stdout and stderr of a run shared by the process and its hooks, so a log file has
+// one rotator and a sink one connection. Writes are serialized, writers are closed after the last release
+type outputWriters struct {
+	mu             sync.Mutex
+	refs           int
+	stdout, stderr io.Writer
+	writeMu        sync.Mutex
+	closed         bool
+	closers        []io.WriteCloser
+}
+
+func newOutputWriters(stdout, stderr io.Writer, closers []io.WriteCloser) *outputWriters {
+	out := &outputWriters{refs: 1, closers: closers}
+	out.stdout, out.stderr = &sharedWriter{out: out, w: stdout}, &sharedWriter{out: out, w: stderr}
+	return out
+}
+
+func (out *outputWriters) acquire() bool {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.refs == 0 {
+		return false
+	}
+	out.refs++
+	return true
+}
+
+func (out *outputWriters) release() {
+	out.mu.Lock()
+	out.refs--
+	last := out.refs == 0
+	out.mu.Unlock()
+	if !last {
+		return
+	}
+	out.writeMu.Lock()
+	defer out.writeMu.Unlock()
+	out.closed = true
+	for _, w := range out.closers {
+		w.Close()
+	}
+}
+
+type sharedWriter struct {
+	out *outputWriters
+	w   io.Writer
+}
+
+func (w *sharedWriter) Write(data []byte) (int, error) {
+	w.out.writeMu.Lock()
+	defer w.out.writeMu.Unlock()
+	if w.out.closed {
+		/* late output of a detached child */
+		return len(data), nil
+	}
+	return w.w.Write(data)
+}
+
+// newCommand creates command with env, cwd and user of process
+func (p *Process) newCommand(command string, args ...string) (*exec.Cmd, error) {
+	cmd := exec.Command(command, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+	cmd.Env = fp.KVStreamOf(p.config.ENV).
+		ZipMap(func(k, v string) string {
+			return fmt.Sprintf(`%s=%s`, k, v)
+		}).
+		Union(fp.StreamOf(os.Environ())).
+		UniqBy(func(pair string) string {
+			return strings.Split(pair, "=")[0]
+		}).
+		Strings()
+	cmd.Dir = p.config.CWD
+	if p.config.SysUser != "" {
+		u, err := user.Lookup(p.config.SysUser)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil && p.config.SysGroup == "" {
+			return nil, err
+		}
+		if p.config.SysGroup != "" {
+			g, err := user.LookupGroup(p.config.SysGroup)
+			if err != nil {
+				return nil, err
+			}
+			gid, err = strconv.ParseUint(g.Gid, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), NoSetGroups: true}
+	}
+	return cmd, nil
+}
+
 func writeCloser(w io.Writer) io.WriteCloser {
 	return &wcloser{Writer: w}
 }
@@ -369,31 +780,60 @@ func (p *Process) runProcessPrepare() (chans.StopChan, func()) {
 	flag := p.stopFlag
 	flag.Add(1)
 
+	p.runMu.Lock()
 	p.config.OmitExitCode = false
 	p.state = Starting
 	p.startTime = time.Now().Unix()
 	p.restartCount = 0
 	p.stopTime = 0
+	p.runMu.Unlock()
+	p.crashes = 0
+	p.stopReason = ""
+	p.emit(EventStarting, "")
 	return flag, func() {
+		p.runMu.Lock()
 		p.state = Stopped
 		p.config.OmitExitCode = false
 		p.stopTime = time.Now().Unix()
+		p.runMu.Unlock()
+		p.emit(EventStopped, p.stopReason)
 		flag.Done()
 	}
 }
 
-func (p *Process) runProcessStartCommand(flag chans.StopChan) error {
-	if err := p.createCommand(); err != nil {
+// runProcessCreateCommand creates command and runs pre_start, it's done before wait_for
+// so a failing pre_start is reported by start
+func (p *Process) runProcessCreateCommand() (*exec.Cmd, error) {
+	cmd, err := p.createCommand()
+	if err != nil {
 		logger.Log("create command fail %v", err)
-		return err
+		return nil, err
 	}
+	return cmd, p.runHook(HookPreStart, p.config.PreStart)
+}
+
+func (p *Process) runProcessStartCommand(flag chans.StopChan, cmd *exec.Cmd) error {
 	var startErr error
-	const maxStartCount = 2
 	for i := 0; i < maxStartCount && !flag.IsStopped(); i++ {
-		if startErr = p.cmd.Start(); startErr != nil {
+		if startErr = startCommand(cmd); startErr != nil {
 			logger.Log("start command fail %v", startErr.Error())
 			time.Sleep(5 * time.Second)
 		} else {
+			if p.listener != nil {
+				p.listener.attach()
+			}
+			if p.output != nil {
+				p.output.started()
+			}
+			done := make(chan struct{})
+			p.runMu.Lock()
+			p.cmd, p.waitDone = cmd, done
+			p.runMu.Unlock()
+			go func() {
+				/* results are read after done is closed */
+				p.waitCode, p.waitErr = reaper.WaitCommand(cmd)
+				close(done)
+			}()
 			return nil
 		}
 	}
@@ -405,16 +845,87 @@ func (p *Process) runProcessStartCommand(flag chans.StopChan) error {
 }
 
 func (p *Process) runProcessUpdateState() {
-	p.state = Running
+	p.setState(Running)
 	if p.config.PidFile != "" {
 		os.MkdirAll(filepath.Dir(p.config.PidFile), 0755)
 		os.WriteFile(p.config.PidFile, []byte(fmt.Sprint(p.cmd.Process.Pid)), 0644)
 	}
 	logger.Log("process %s started", p.config.Name)
+	p.emit(EventRunning, "")
+}
+
+// runProcessWaitFor waits all wait_for conditions, a timeout is a failed start attempt
+func (p *Process) runProcessWaitFor(flag chans.StopChan) error {
+	p.setState(Waiting)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-flag.C():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	timeout := time.Duration(firstPositive(p.config.WaitForTimeoutSecs, defaultWaitForTimeoutSecs)) * time.Second
+	var err error
+	for i := 0; i < maxStartCount && !flag.IsStopped(); i++ {
+		if err = p.waitConditions(ctx, timeout); err == nil {
+			p.setState(Starting)
+			return nil
+		}
+		logger.Log("process %s wait_for fail %v", p.config.Name, err)
+	}
+	if flag.IsStopped() {
+		return errors.New(`abandon start command`)
+	}
+	return err
+}
+
+func (p *Process) waitConditions(ctx context.Context, timeout time.Duration) error {
+	for _, target := range p.config.WaitFor {
+		logger.Log("process %s wait for %s", p.config.Name, target)
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+		err := p.waitProbe(tctx, target)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runProcessWaitReady waits READY=1 of notify process and arms watchdog
+func (p *Process) runProcessWaitReady() error {
+	n, cmd := p.notifier, p.cmd
+	if n == nil {
+		return nil
+	}
+	if p.config.Notify {
+		timeout := time.Duration(firstPositive(p.config.NotifyTimeoutSecs, defaultNotifyTimeoutSecs)) * time.Second
+		if !n.waitReady(timeout, p.waitDone) {
+			select {
+			case <-p.waitDone:
+				return fmt.Errorf("process %s exited before ready", p.config.Name)
+			default:
+			}
+			logger.Log("process %s is not ready after %v, kill it", p.config.Name, timeout)
+			signals.Kill(cmd.Process, syscall.SIGKILL, true)
+			return fmt.Errorf("process %s is not ready after %v", p.config.Name, timeout)
+		}
+		logger.Log("process %s is ready", p.config.Name)
+	}
+	if p.config.WatchdogSecs > 0 {
+		go n.watch(time.Duration(p.config.WatchdogSecs)*time.Second, func() {
+			logger.Log("process %s missed watchdog, kill it for restart", p.config.Name)
+			signals.Kill(cmd.Process, syscall.SIGKILL, true)
+		})
+	}
+	return nil
 }
 
 func (p *Process) runProcessWait(flag chans.StopChan) {
-	if err := p.cmd.Wait(); err != nil {
+	<-p.waitDone
+	if err := p.waitErr; err != nil {
 		if strings.Contains(err.Error(), `killed`) && !flag.IsStopped() {
 			logger.Log("process %s terminated with %v, maybe OOM", p.config.Name, err.Error())
 		} else {
@@ -423,39 +934,103 @@ func (p *Process) runProcessWait(flag chans.StopChan) {
 	}
 }
 
-func (p *Process) runProcessCheckResult(flag chans.StopChan) (shouldRestart bool) {
-	/* check exit code */
+func (p *Process) exitCodeMatch() bool {
 	exitCodes := p.config.ExitCodes
 	if len(exitCodes) == 0 {
 		exitCodes = []int{config.DefaultSuccessExitCode}
 	}
-	exitCodeMatch := fp.StreamOf(exitCodes).ContainsBy(func(code int) bool {
-		return p.cmd.ProcessState.ExitCode() == code || p.config.OmitExitCode
+	p.runMu.RLock()
+	omit := p.config.OmitExitCode
+	p.runMu.RUnlock()
+	return fp.StreamOf(exitCodes).ContainsBy(func(code int) bool {
+		return p.waitCode == code || omit
 	})
+}
+
+// giveUp reports whether process exits too fast for start_retries times in a row, FATAL is emitted then
+func (p *Process) giveUp() bool {
+	if time.Now().Unix()-p.startTime < crashLoopSecs {
+		p.crashes++
+	} else {
+		p.crashes = 1
+	}
+	if p.config.StartRetries <= 0 || p.crashes <= p.config.StartRetries {
+		return false
+	}
+	msg := fmt.Sprintf("exited %d times in a row within %ds of start, give up", p.crashes, crashLoopSecs)
+	logger.Log("process %s %s", p.config.Name, msg)
+	p.stopReason = msg
+	p.emit(EventFatal, msg)
+	p.fail(p.waitCode)
+	return true
+}
+
+// fail reports process is finished with failure, code is 1 if it never ran
+func (p *Process) fail(code int) {
+	if p.failed != nil {
+		p.failed(code)
+	}
+}
+
+func (p *Process) runProcessCheckResult(flag chans.StopChan) (shouldRestart bool) {
+	/* check exit code */
+	exitCodeMatch := p.exitCodeMatch()
+	restarting := flag.IsStopped() && p.restarting.Swap(false)
+	code := p.waitCode
+	p.runMu.Lock()
+	p.exitCode = &code
+	p.runMu.Unlock()
+	p.emit(EventExited, "")
 	switch {
+	case p.isJob() && !flag.IsStopped():
+		/* jobs are never restarted, scheduled jobs are never done */
+		logger.Log("process %s run finished with code %v", p.config.Name, code)
+		if p.cron == nil {
+			if exitCodeMatch {
+				p.cb(false)
+			} else {
+				p.fail(code)
+			}
+		}
 	case exitCodeMatch:
 		if flag.IsStopped() {
-			logger.Log("process %s exit with code %v, user op.", p.config.Name, p.cmd.ProcessState.ExitCode())
+			logger.Log("process %s exit with code %v, user op.", p.config.Name, code)
 		} else {
-			logger.Log("process %s exit with code %v, treat as success", p.config.Name, p.cmd.ProcessState.ExitCode())
+			logger.Log("process %s exit with code %v, treat as success", p.config.Name, code)
+		}
+		if !restarting {
+			p.cb(flag.IsStopped())
 		}
-		p.cb(flag.IsStopped())
 	case !exitCodeMatch && flag.IsStopped():
-		logger.Log("process %s exit with code %v", p.config.Name, p.cmd.ProcessState.ExitCode())
+		logger.Log("process %s exit with code %v", p.config.Name, code)
 	case !exitCodeMatch && !flag.IsStopped():
-		logger.Log("process %s UNEXPECTED exit with code %v, will restart", p.config.Name, p.cmd.ProcessState.ExitCode())
+		logger.Log("process %s UNEXPECTED exit with code %v, will restart", p.config.Name, code)
 		return true
 	}
 	return false
 }
 
+const (
+	maxStartCount             = 2
+	crashLoopSecs             = 60
+	defaultWaitForTimeoutSecs = 60
+)
+
 func firstPositive(nums ...int) int {
 	return fp.StreamOf(nums).Filter(func(n int) bool { return n > 0 }).First().Int()
 }
 
 func parseMaxLogSize(keepSize string) int64 {
+	if v := parseSize(keepSize); v > 0 {
+		return v
+	}
+	return 1 * filelog.G
+}
+
+// parseSize parse size like 1G/100M/10K/1024, return 0 if invalid
+func parseSize(size string) int64 {
 	parse := func(unit string) (int64, bool) {
-		str := strings.ToUpper(keepSize)
+		str := strings.ToUpper(size)
 		if strings.HasSuffix(str, unit) {
 			v, _ := strconv.ParseInt(strings.TrimSuffix(str, unit), 10, 64)
 			return v, v > 0
@@ -471,8 +1046,8 @@ func parseMaxLogSize(keepSize string) int64 {
 	if v, ok := parse("K"); ok {
 		return v * filelog.K
 	}
-	if v, _ := strconv.ParseInt(keepSize, 10, 64); v > 0 {
+	if v, _ := strconv.ParseInt(size, 10, 64); v > 0 {
 		return v
 	}
-	return 1 * filelog.G
+	return 0
 }
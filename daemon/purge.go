@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+/* system directories never touched by purge */
+var purgeSystemDirs = []string{"/dev", "/proc", "/sys"}
+
+// PurgeLogs removes log files and purge_files of current config,
+// with dryRun only prints what would be deleted
+func PurgeLogs(dryRun bool, w io.Writer) error {
+	return purgeFiles(collectPurgeFiles(config.Provider().GetConfig()), dryRun, w)
+}
+
+func purgeFiles(patterns []string, dryRun bool, w io.Writer) error {
+	protected := purgeProtectedPaths()
+	var failed int
+	now := func() string { return time.Now().Format(`2006-01-02 15:04:05`) }
+	for _, file := range expandPurgePatterns(patterns) {
+		if err := checkPurgePath(file, protected); err != nil {
+			fmt.Fprintf(w, "[%s] refuse to remove %v: %v\n", now(), file, err)
+			failed++
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(w, "[%s] would remove %v\n", now(), file)
+			continue
+		}
+		/* RemoveAll removes symlinks themselves and never follows them */
+		if err := os.RemoveAll(file); err != nil {
+			fmt.Fprintf(w, "[%s] remove log %v fail %v\n", now(), file, err)
+			failed++
+		} else {
+			fmt.Fprintf(w, "[%s] remove log %v success\n", now(), file)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files not purged", failed)
+	}
+	return nil
+}
+
+// expandPurgePatterns expands glob patterns into existing paths,
+// nested paths are dropped since their parent is removed as a whole
+func expandPurgePatterns(patterns []string) []string {
+	set := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			if abs, err := filepath.Abs(m); err == nil {
+				set[abs] = true
+			}
+		}
+	}
+	var list []string
+	for file := range set {
+		list = append(list, file)
+	}
+	sort.Strings(list)
+	var ret []string
+	for _, file := range list {
+		if len(ret) > 0 && isSubPath(ret[len(ret)-1], file) {
+			continue
+		}
+		ret = append(ret, file)
+	}
+	return ret
+}
+
+func purgeProtectedPaths() []string {
+	list := []string{"/", config.SupervisordDir()}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		list = append(list, home)
+	}
+	if file, err := config.ConfigFile(); err == nil {
+		list = append(list, file, filepath.Dir(file))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		list = append(list, wd)
+	}
+	var ret []string
+	for _, p := range list {
+		if abs, err := filepath.Abs(p); err == nil {
+			ret = append(ret, abs)
+			if real, err := filepath.EvalSymlinks(abs); err == nil {
+				ret = append(ret, real)
+			}
+		}
+	}
+	return ret
+}
+
+// checkPurgePath refuses paths which are or contain a protected path,
+// the check is done on both the path and the path with its parent symlinks resolved
+func checkPurgePath(file string, protected []string) error {
+	candidates := []string{file}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(file)); err == nil {
+		candidates = append(candidates, filepath.Join(dir, filepath.Base(file)))
+	}
+	for _, c := range candidates {
+		if filepath.Dir(c) == "/" {
+			return fmt.Errorf("top level directory")
+		}
+		for _, dir := range purgeSystemDirs {
+			if isSubPath(dir, c) {
+				return fmt.Errorf("system directory %s", dir)
+			}
+		}
+		for _, p := range protected {
+			if isSubPath(c, p) {
+				return fmt.Errorf("contains protected path %s", p)
+			}
+		}
+	}
+	return nil
+}
+
+// isSubPath reports whether b equals a or is inside a
+func isSubPath(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return strings.HasPrefix(b, strings.TrimSuffix(a, "/")+"/")
+}
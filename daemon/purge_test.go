@@ -0,0 +1,60 @@
+package daemon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPurgeFiles(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "log")
+	keepDir := filepath.Join(dir, "keep")
+	os.MkdirAll(logDir, 0755)
+	os.MkdirAll(keepDir, 0755)
+	os.WriteFile(filepath.Join(logDir, "app.log.1"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(logDir, "app.log.2"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(keepDir, "data"), []byte("x"), 0644)
+	/* a symlink pointing outside must be removed as a link only */
+	os.Symlink(keepDir, filepath.Join(logDir, "app.log.link"))
+
+	out := new(bytes.Buffer)
+	if err := purgeFiles([]string{filepath.Join(logDir, "app.log*")}, true, out); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "would remove"); n != 3 {
+		t.Fatalf("dry run output %s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "app.log.1")); err != nil {
+		t.Fatal("dry run removed file")
+	}
+
+	out.Reset()
+	if err := purgeFiles([]string{filepath.Join(logDir, "app.log*")}, false, out); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(logDir, "*")); len(matches) != 0 {
+		t.Fatalf("files left %v", matches)
+	}
+	if _, err := os.Stat(filepath.Join(keepDir, "data")); err != nil {
+		t.Fatal("symlink target removed")
+	}
+}
+
+func TestPurgeRefuseDangerousPath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	protected := []string{"/", home}
+	for _, p := range []string{"/", "/usr", "/dev/stdout", filepath.Dir(home), home} {
+		if p == "" {
+			continue
+		}
+		if err := checkPurgePath(p, protected); err == nil {
+			t.Fatalf("%s should be refused", p)
+		}
+	}
+	if err := checkPurgePath(filepath.Join(t.TempDir(), "x.log"), protected); err != nil {
+		t.Fatal(err)
+	}
+}
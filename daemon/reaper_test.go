@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+	"github.com/qjpcpu/supervisord/reaper"
+)
+
+func TestReapZombieKeepsExitCode(t *testing.T) {
+	/* as reap_zombie = true does when supervisord is pid 1 */
+	reaper.Start(reaper.Config{Pid: -1, DisablePid1Check: true})
+	defer reaper.Stop()
+	ch, cancel := events.Subscribe(EventFilter{Names: []string{"reaped"}, Types: []string{string(EventExited)}}, 16)
+	defer cancel()
+	cnf := (&config.ProcessConfig{
+		Name:     "reaped",
+		Command:  "/bin/sh",
+		Args:     []string{"-c", "sleep 0.2; exit 3"},
+		Stdout:   []string{"/dev/null"},
+		Type:     ProcessTypeOneshot,
+		PreStart: "exit 0",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	for i := 0; i < 5; i++ {
+		if err := p.RunNow(); err != nil {
+			t.Fatalf("hook exit status should not be stolen: %v", err)
+		}
+		select {
+		case e := <-ch:
+			if e.ExitCode != 3 || e.Expected {
+				t.Fatalf("exit code should be preserved, got %+v", e)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("process should exit")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if st := p.GetState(); st.ExitCode == nil || *st.ExitCode != 3 || st.Restart != 0 {
+			t.Fatalf("bad state %+v", st)
+		}
+	}
+
+	/* unknown children are still reaped as zombies */
+	stray := exec.Command("/bin/true")
+	if err := stray.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, _, err := procStat(stray.Process.Pid); err == nil {
+		t.Fatal("zombie should be reaped")
+	}
+}
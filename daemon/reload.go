@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+/* process which does not exit this long after reload signal survived it */
+var reloadSettleInterval = time.Second
+
+// SignalReload sends reload_signal to process without touching its state,
+// then confirms process is still running and healthy if health_check is configured
+func (p *Process) SignalReload(ctx context.Context) error {
+	exited, err := p.sendReloadSignal()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-exited:
+		return fmt.Errorf("process %s exited after reload signal", p.config.Name)
+	case <-time.After(reloadSettleInterval):
+	}
+	if p.config.HealthCheck == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(firstPositive(p.config.HealthCheckTimeoutSecs, defaultHealthCheckTimeoutSecs))*time.Second)
+	defer cancel()
+	if err := p.waitProbe(ctx, p.config.HealthCheck); err != nil {
+		logger.Log("process %s is unhealthy after reload %v", p.config.Name, err)
+		return fmt.Errorf("process %s is unhealthy after reload: %v", p.config.Name, err)
+	}
+	logger.Log("process %s reloaded and healthy", p.config.Name)
+	return nil
+}
+
+// sendReloadSignal sends reload_signal to process leader, it returns channel closed once the signalled run exits
+func (p *Process) sendReloadSignal() (<-chan struct{}, error) {
+	if p.config.ReloadSignal == "" {
+		return nil, fmt.Errorf("process %s has no reload_signal", p.config.Name)
+	}
+	sig, err := signals.ToSignal(p.config.ReloadSignal)
+	if err != nil {
+		return nil, err
+	}
+	cmd, exited := p.lastRun()
+	if !p.isRunning() || cmd == nil || cmd.Process == nil || exited == nil {
+		return nil, fmt.Errorf("process %s is not running", p.config.Name)
+	}
+	select {
+	case <-exited:
+		return nil, fmt.Errorf("process %s is not running", p.config.Name)
+	default:
+	}
+	logger.Log("send reload signal %s to process %s", p.config.ReloadSignal, p.config.Name)
+	return exited, signals.Kill(cmd.Process, sig, false)
+}
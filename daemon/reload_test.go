@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	p := NewProcess((&config.ProcessConfig{Name: "probe", Command: "true"}).FillDefaults(), func(bool) {})
+	defer p.Shutdown(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for target, ok := range map[string]bool{
+		"tcp://" + ln.Addr().String(): true,
+		"tcp://127.0.0.1:1":           false,
+		"exec:test 1 -eq 1":           true,
+		"exec:exit 3":                 false,
+		"ftp://127.0.0.1":             false,
+	} {
+		if err := p.probe(ctx, target); (err == nil) != ok {
+			t.Fatalf("probe %s expect ok=%v, got %v", target, ok, err)
+		}
+	}
+}
+
+func TestSignalReload(t *testing.T) {
+	reloadSettleInterval = 100 * time.Millisecond
+	t.Cleanup(func() { reloadSettleInterval = time.Second })
+	out := filepath.Join(t.TempDir(), "reloaded")
+	cnf := (&config.ProcessConfig{
+		Name:         "reloadable",
+		Command:      "/bin/sh",
+		Args:         []string{"-c", `trap "touch $OUT" HUP; while true; do sleep 0.1; done`},
+		ENV:          map[string]string{"OUT": out},
+		Stdout:       []string{"/dev/null"},
+		ReloadSignal: "HUP",
+		HealthCheck:  "exec:test -f $OUT",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	pid := p.command().Process.Pid
+	if err := p.SignalReload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Fatal("process did not receive reload signal")
+	}
+	if p.currentState() != Running || p.command().Process.Pid != pid {
+		t.Fatalf("process should keep running, state=%v", p.currentState())
+	}
+
+	p.config.ReloadSignal = "TERM"
+	if err := p.SignalReload(context.Background()); err == nil {
+		t.Fatal("exited process should fail reload")
+	}
+}
@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRollingWaitHealthy = 30 * time.Second
+
+// RollingProgress is streamed to client during rolling restart
+type RollingProgress struct {
+	Batch   int    `json:",omitempty"`
+	Batches int    `json:",omitempty"`
+	Process string `json:",omitempty"`
+	Message string
+	Failed  bool `json:",omitempty"`
+	Done    bool `json:",omitempty"`
+}
+
+// RollingRestart restarts processes selected by all or group:G in batches, next batch is restarted
+// only after all members of current batch are healthy, remaining batches are untouched on failure
+func (s *Supervisord) RollingRestart(ctx context.Context, selector string, batch int, waitHealthy time.Duration, progress func(*RollingProgress)) error {
+	list, err := s.selectProcesses(selector)
+	if err != nil {
+		return err
+	}
+	if batch <= 0 {
+		batch = 1
+	}
+	if waitHealthy <= 0 {
+		waitHealthy = defaultRollingWaitHealthy
+	}
+	batches := (len(list) + batch - 1) / batch
+	var mu sync.Mutex
+	report := func(pg *RollingProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress(pg)
+	}
+	for i := 0; i < batches; i++ {
+		members := list[i*batch : min((i+1)*batch, len(list))]
+		var names []string
+		for _, p := range members {
+			names = append(names, p.config.Name)
+		}
+		report(&RollingProgress{Batch: i + 1, Batches: batches, Message: "restart " + strings.Join(names, ",")})
+		errs := make([]error, len(members))
+		wg := new(sync.WaitGroup)
+		for j, p := range members {
+			wg.Add(1)
+			go func(j int, p *Process) {
+				defer wg.Done()
+				errs[j] = s.restartHealthy(ctx, p, waitHealthy)
+				msg := "healthy"
+				if errs[j] != nil {
+					msg = errs[j].Error()
+				}
+				report(&RollingProgress{Batch: i + 1, Batches: batches, Process: p.config.Name, Message: msg, Failed: errs[j] != nil})
+			}(j, p)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				logger.Log("rolling restart %s abort at batch %d/%d %v", selector, i+1, batches, err)
+				return fmt.Errorf("batch %d/%d failed, remaining processes are untouched: %v", i+1, batches, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Supervisord) restartHealthy(ctx context.Context, p *Process, waitHealthy time.Duration) error {
+	p.Stop(false)
+	s.processDone.Delete(p.config.Name)
+	if err := p.Start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, waitHealthy)
+	defer cancel()
+	return p.waitHealthy(ctx)
+}
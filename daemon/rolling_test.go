@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestRollingRestart(t *testing.T) {
+	healthySettleInterval = 100 * time.Millisecond
+	t.Cleanup(func() { healthySettleInterval = time.Second })
+	s := newTestSupervisord()
+	for _, name := range []string{"web1", "web2", "web3"} {
+		cnf := (&config.ProcessConfig{
+			Name:      name,
+			Command:   "/bin/sh",
+			Args:      []string{"-c", `while true; do sleep 0.1; done`},
+			Stdout:    []string{"/dev/null"},
+			ProcGroup: "web",
+		}).FillDefaults()
+		p := NewProcess(cnf, func(bool) {})
+		if err := p.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer p.Shutdown(true)
+		s.processMap[name] = p
+		time.Sleep(10 * time.Millisecond)
+	}
+	pids := func() (list []int) {
+		for _, p := range s.GetProcessList() {
+			list = append(list, p.command().Process.Pid)
+		}
+		return
+	}
+	before := pids()
+	var progress []*RollingProgress
+	report := func(pg *RollingProgress) { progress = append(progress, pg) }
+	if err := s.RollingRestart(context.Background(), "group:web", 2, time.Second, report); err != nil {
+		t.Fatal(err)
+	}
+	after := pids()
+	for i := range before {
+		if before[i] == after[i] {
+			t.Fatalf("process %d is not restarted", i)
+		}
+	}
+	if len(progress) != 5 || progress[3].Batch != 2 || progress[3].Process != "" {
+		t.Fatalf("unexpected progress %d", len(progress))
+	}
+
+	/* unhealthy first batch aborts rolling restart */
+	s.processMap["web1"].config.HealthCheck = "exec:exit 1"
+	before = pids()
+	if err := s.RollingRestart(context.Background(), "all", 1, 500*time.Millisecond, func(*RollingProgress) {}); err == nil {
+		t.Fatal("unhealthy batch should abort")
+	}
+	after = pids()
+	if before[0] == after[0] || before[1] != after[1] || before[2] != after[2] {
+		t.Fatalf("only first batch should be restarted %v %v", before, after)
+	}
+}
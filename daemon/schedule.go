@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ProcessTypeOneshot = "oneshot"
+
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+	OverlapKill  = "kill"
+)
+
+// cronJob runs a scheduled process on its timetable while armed
+type cronJob struct {
+	p     *Process
+	sched *cronSchedule
+	mu    sync.Mutex
+	stop  chan struct{}
+	next  time.Time
+}
+
+func newCronJob(p *Process, spec string) (*cronJob, error) {
+	sched, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &cronJob{p: p, sched: sched}, nil
+}
+
+// Arm starts timetable, it is a no-op if already armed
+func (j *cronJob) Arm() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stop != nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	go j.loop(j.stop)
+}
+
+// Disarm stops timetable, a running instance is not affected
+func (j *cronJob) Disarm() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stop != nil {
+		close(j.stop)
+		j.stop = nil
+	}
+	j.next = time.Time{}
+}
+
+func (j *cronJob) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.next
+}
+
+func (j *cronJob) loop(stop chan struct{}) {
+	for {
+		next := j.sched.Next(time.Now())
+		if next.IsZero() {
+			logger.Log("schedule of process %s never fires", j.p.config.Name)
+			return
+		}
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+		select {
+		case <-time.After(time.Until(next)):
+			go j.p.runJob()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *Process) isJob() bool {
+	return p.cron != nil || p.config.Type == ProcessTypeOneshot
+}
+
+// RunNow triggers a run of scheduled or oneshot process immediately, overlap_policy applies
+func (p *Process) RunNow() error {
+	if p.cronErr != nil {
+		return p.cronErr
+	}
+	if !p.isJob() {
+		return fmt.Errorf("process %s is not a scheduled or oneshot job", p.config.Name)
+	}
+	return p.runJob()
+}
+
+// runJob starts one run, overlap_policy decides what to do if previous run is still active
+func (p *Process) runJob() error {
+	if p.GetState().State.Active() {
+		switch p.config.OverlapPolicy {
+		case OverlapQueue:
+			logger.Log("process %s is still running, queue next run", p.config.Name)
+			p.jobQueued.Store(true)
+			return nil
+		case OverlapKill:
+			logger.Log("process %s is still running, stop it for next run", p.config.Name)
+			p.stop(false)
+		default:
+			logger.Log("process %s is still running, skip this run", p.config.Name)
+			return nil
+		}
+	}
+	return p.start()
+}
+
+// onJobExit starts queued run after a run is finished
+func (p *Process) onJobExit() {
+	if p.isJob() && p.jobQueued.Swap(false) {
+		go p.runJob()
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestOneshotJob(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "runs")
+	cnf := (&config.ProcessConfig{
+		Name:          "job",
+		Command:       "/bin/sh",
+		Args:          []string{"-c", `echo run >> "$OUT"; sleep 0.3; exit 3`},
+		ENV:           map[string]string{"OUT": out},
+		Stdout:        []string{"/dev/null"},
+		Type:          ProcessTypeOneshot,
+		OverlapPolicy: OverlapQueue,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	if err := p.RunNow(); err != nil {
+		t.Fatal(err)
+	}
+	/* second run is queued behind the first one */
+	time.Sleep(100 * time.Millisecond)
+	if err := p.RunNow(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	data, _ := os.ReadFile(out)
+	if n := strings.Count(string(data), "run"); n != 2 {
+		t.Fatalf("failed oneshot should not be restarted, queued run should run once, got %d runs", n)
+	}
+	st := p.GetState()
+	if st.State != Stopped || st.ExitCode == nil || *st.ExitCode != 3 || st.Restart != 0 {
+		t.Fatalf("bad state %+v", st)
+	}
+}
+
+func TestScheduledJob(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:     "cron",
+		Command:  "/bin/true",
+		Stdout:   []string{"/dev/null"},
+		Schedule: "0 0 1 1 *",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) { t.Fatal("scheduled job should never be done") })
+	defer p.Shutdown(true)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	st := p.GetState()
+	if st.State != WaitSchedule || st.NextRun != p.cron.sched.Next(time.Now()).Unix() {
+		t.Fatalf("scheduled job should wait for next run, got %+v", st)
+	}
+	p.RunNow()
+	time.Sleep(300 * time.Millisecond)
+	if st := p.GetState(); st.ExitCode == nil || *st.ExitCode != 0 || st.NextRun == 0 {
+		t.Fatalf("bad state after run %+v", st)
+	}
+	p.Stop(false)
+	if st := p.GetState(); st.NextRun != 0 {
+		t.Fatal("stopped job should be disarmed")
+	}
+
+	bad := NewProcess((&config.ProcessConfig{Name: "bad", Command: "/bin/true", Schedule: "* *"}).FillDefaults(), func(bool) {})
+	defer bad.Shutdown(true)
+	if err := bad.Start(); err == nil {
+		t.Fatal("bad schedule should fail start")
+	}
+}
+
+func TestRunJobAfterShutdown(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:     "late",
+		Command:  "/bin/true",
+		Stdout:   []string{"/dev/null"},
+		Schedule: "* * * * *",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	p.Shutdown(true)
+	/* as a timer firing at the same moment as shutdown does */
+	done := make(chan error, 1)
+	go func() { done <- p.runJob() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("run after shutdown should fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run after shutdown should never block")
+	}
+}
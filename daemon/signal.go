@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+const groupSelectorPrefix = "group:"
+
+// Signal sends sig to process group, or only the process itself when leaderOnly
+func (p *Process) Signal(sig os.Signal, leaderOnly bool) error {
+	cmd := p.command()
+	if !p.isRunning() || cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("process %s is not running", p.config.Name)
+	}
+	logger.Log("send signal %v to process %s, leader only %v", sig, p.config.Name, leaderOnly)
+	return signals.Kill(cmd.Process, sig, !leaderOnly)
+}
+
+// SignalProcess sends signal to processes selected by NAME, all or group:G,
+// stopped processes are skipped unless selected by name
+func (s *Supervisord) SignalProcess(ctx context.Context, selector string, sigName string, leaderOnly bool) error {
+	sig, err := signals.ToSignal(sigName)
+	if err != nil {
+		return err
+	}
+	list, err := s.selectProcesses(selector)
+	if err != nil {
+		return err
+	}
+	byName := selector != "all" && !strings.HasPrefix(selector, groupSelectorPrefix)
+	var errs []error
+	for _, p := range list {
+		if !byName && !p.isRunning() {
+			continue
+		}
+		if err := p.Signal(sig, leaderOnly); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selectProcesses returns processes by selector: process name, all or group:G
+func (s *Supervisord) selectProcesses(selector string) ([]*Process, error) {
+	var list []*Process
+	switch {
+	case selector == "all":
+		list = s.GetProcessList()
+	case strings.HasPrefix(selector, groupSelectorPrefix):
+		group := strings.TrimPrefix(selector, groupSelectorPrefix)
+		for _, p := range s.GetProcessList() {
+			if p.config.ProcGroup == group {
+				list = append(list, p)
+			}
+		}
+	default:
+		s.processMutex.RLock()
+		p, ok := s.processMap[selector]
+		s.processMutex.RUnlock()
+		if ok {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no process matches %s", selector)
+	}
+	return list, nil
+}
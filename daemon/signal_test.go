@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestSignalProcess(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestSupervisord()
+	for _, name := range []string{"web1", "web2", "worker"} {
+		group := "web"
+		if name == "worker" {
+			group = ""
+		}
+		cnf := (&config.ProcessConfig{
+			Name:      name,
+			Command:   "/bin/sh",
+			Args:      []string{"-c", `trap "touch $OUT" USR1; while true; do sleep 0.1; done`},
+			ENV:       map[string]string{"OUT": filepath.Join(dir, name)},
+			Stdout:    []string{"/dev/null"},
+			ProcGroup: group,
+		}).FillDefaults()
+		p := NewProcess(cnf, func(bool) {})
+		if err := p.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer p.Shutdown(true)
+		s.processMap[name] = p
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if err := s.SignalProcess(context.Background(), "group:web", "SIGFOO", false); err == nil {
+		t.Fatal("unknown signal should be rejected")
+	}
+	if err := s.SignalProcess(context.Background(), "group:nope", "USR1", false); err == nil {
+		t.Fatal("empty selection should be rejected")
+	}
+	if err := s.SignalProcess(context.Background(), "group:web", "usr1", true); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	for name, want := range map[string]bool{"web1": true, "web2": true, "worker": false} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Fatalf("process %s signaled=%v, want %v", name, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSinkBufferSize = 1024
+	maxSinkReconnectWait  = 30 * time.Second
+	/* a stalled peer must not hang process stop */
+	tcpSinkWriteTimeout = 5 * time.Second
+	tcpSinkCloseTimeout = 3 * time.Second
+)
+
+// isURLSink reports whether a std target is a url style sink such as
+// syslog://, unix:// or tcp:// instead of a plain file path
+func isURLSink(target string) bool {
+	return strings.Contains(target, "://")
+}
+
+// newSinkWriter creates writer for url style std target:
+//
+//	syslog://[host:port][/path/to/dev/log][?proto=udp|tcp&facility=local0&severity=info&tag=name]
+//	unix:///path/to/datagram.sock
+//	tcp://host:port[?buffer=1024]
+//
+// every sink receives output line by line, partial lines are kept until newline or close
+func newSinkWriter(target string, name string) (io.WriteCloser, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("bad sink %s: %v", target, err)
+	}
+	var w lineSink
+	switch u.Scheme {
+	case "syslog":
+		w, err = newSyslogSink(u, name)
+	case "unix":
+		w, err = newUnixgramSink(u.Path)
+	case "tcp":
+		w, err = newTCPSink(u)
+	default:
+		return nil, fmt.Errorf("not supported sink %s", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newLineBuffer(w), nil
+}
+
+// lineSink accepts complete lines without the trailing newline
+type lineSink interface {
+	WriteLine(line []byte) error
+	Close() error
+}
+
+// truncatedSink is a lineSink which is told how many bytes of an over long line lineBuffer dropped
+type truncatedSink interface {
+	WriteTruncated(line []byte, skipped int) error
+}
+
+// lineBuffer splits a byte stream into lines for a lineSink
+type lineBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	sink lineSink
+	/* max bytes kept for a partial line, 0 means unlimited */
+	limit int
+	/* bytes dropped from the current over long line */
+	skipped int
+}
+
+func newLineBuffer(sink lineSink) *lineBuffer {
+	return &lineBuffer{sink: sink}
+}
+
+func (lb *lineBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.buf = append(lb.buf, p...)
+	for {
+		i := bytes.IndexByte(lb.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lb.emit(lb.buf[:i])
+		lb.buf = lb.buf[i+1:]
+	}
+	/* keep only the head of an over long partial line and count the rest */
+	if lb.limit > 0 && len(lb.buf) > lb.limit {
+		lb.skipped += len(lb.buf) - lb.limit
+		lb.buf = lb.buf[:lb.limit]
+	}
+	if len(lb.buf) == 0 {
+		lb.buf = nil
+	}
+	return len(p), nil
+}
+
+func (lb *lineBuffer) emit(line []byte) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	skipped := lb.skipped
+	lb.skipped = 0
+	if ts, ok := lb.sink.(truncatedSink); ok && skipped > 0 {
+		ts.WriteTruncated(line, skipped)
+		return
+	}
+	lb.sink.WriteLine(line)
+}
+
+func (lb *lineBuffer) Close() error {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if len(lb.buf) > 0 || lb.skipped > 0 {
+		lb.emit(lb.buf)
+		lb.buf = nil
+	}
+	return lb.sink.Close()
+}
+
+type unixgramSink struct {
+	path string
+	conn net.Conn
+}
+
+func newUnixgramSink(path string) (*unixgramSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix sink lost socket path")
+	}
+	s := &unixgramSink{path: path}
+	/* the peer may come up later, so dial lazily if it is not ready */
+	s.conn, _ = net.Dial("unixgram", path)
+	return s, nil
+}
+
+func (s *unixgramSink) WriteLine(line []byte) error {
+	if s.conn == nil {
+		conn, err := net.Dial("unixgram", s.path)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write(line); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *unixgramSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// tcpSink ships lines to a tcp peer through a bounded buffer,
+// lines are dropped when the buffer is full and the connection is
+// re-established in background after failure
+type tcpSink struct {
+	addr    string
+	lines   chan []byte
+	closeCh chan struct{}
+	done    chan struct{}
+	dropped int64
+	once    sync.Once
+}
+
+func newTCPSink(u *url.URL) (*tcpSink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("tcp sink lost host:port")
+	}
+	size := defaultSinkBufferSize
+	if str := u.Query().Get("buffer"); str != "" {
+		n, err := strconv.Atoi(str)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad tcp sink buffer %s", str)
+		}
+		size = n
+	}
+	s := &tcpSink{
+		addr:    u.Host,
+		lines:   make(chan []byte, size),
+		closeCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.ship()
+	return s, nil
+}
+
+func (s *tcpSink) WriteLine(line []byte) error {
+	data := make([]byte, len(line)+1)
+	copy(data, line)
+	data[len(line)] = '\n'
+	select {
+	case s.lines <- data:
+		return nil
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		return fmt.Errorf("tcp sink %s buffer full", s.addr)
+	}
+}
+
+func (s *tcpSink) Close() error {
+	s.once.Do(func() {
+		close(s.closeCh)
+		select {
+		case <-s.done:
+		case <-time.After(tcpSinkCloseTimeout):
+			logger.Log("tcp sink %s is not closed in %v, give up pending lines", s.addr, tcpSinkCloseTimeout)
+		}
+	})
+	return nil
+}
+
+func (s *tcpSink) ship() {
+	defer close(s.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	wait := time.Second
+	var pending []byte
+	for {
+		if pending == nil {
+			select {
+			case pending = <-s.lines:
+			case <-s.closeCh:
+				s.flush(conn)
+				return
+			}
+		}
+		if conn == nil {
+			c, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+			if err != nil {
+				select {
+				case <-time.After(wait):
+				case <-s.closeCh:
+					return
+				}
+				wait = minDuration(wait*2, maxSinkReconnectWait)
+				continue
+			}
+			conn, wait = c, time.Second
+			if n := atomic.SwapInt64(&s.dropped, 0); n > 0 {
+				fmt.Fprintf(conn, "[supervisord] %d lines dropped\n", n)
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(tcpSinkWriteTimeout))
+		if _, err := conn.Write(pending); err != nil {
+			conn.Close()
+			conn = nil
+			select {
+			case <-s.closeCh:
+				return
+			default:
+			}
+			continue
+		}
+		pending = nil
+	}
+}
+
+/* flush buffered lines best effort before closing */
+func (s *tcpSink) flush(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	for {
+		select {
+		case line := <-s.lines:
+			if _, err := conn.Write(line); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
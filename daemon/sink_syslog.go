@@ -0,0 +1,99 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+var syslogSeverities = map[string]syslog.Priority{
+	"emerg":   syslog.LOG_EMERG,
+	"alert":   syslog.LOG_ALERT,
+	"crit":    syslog.LOG_CRIT,
+	"err":     syslog.LOG_ERR,
+	"warning": syslog.LOG_WARNING,
+	"notice":  syslog.LOG_NOTICE,
+	"info":    syslog.LOG_INFO,
+	"debug":   syslog.LOG_DEBUG,
+}
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// syslog://                      local syslog daemon
+// syslog:///dev/log              local unix datagram socket
+// syslog://host:514?proto=tcp    remote syslog, udp by default
+func newSyslogSink(u *url.URL, name string) (*syslogSink, error) {
+	q := u.Query()
+	facility, severity := syslog.LOG_USER, syslog.LOG_INFO
+	if str := q.Get("facility"); str != "" {
+		f, ok := syslogFacilities[strings.ToLower(str)]
+		if !ok {
+			return nil, fmt.Errorf("bad syslog facility %s", str)
+		}
+		facility = f
+	}
+	if str := q.Get("severity"); str != "" {
+		s, ok := syslogSeverities[strings.ToLower(str)]
+		if !ok {
+			return nil, fmt.Errorf("bad syslog severity %s", str)
+		}
+		severity = s
+	}
+	tag := q.Get("tag")
+	if tag == "" {
+		tag = name
+	}
+	var network, raddr string
+	switch {
+	case u.Host != "":
+		network, raddr = "udp", u.Host
+		if proto := q.Get("proto"); proto != "" {
+			network = proto
+		}
+	case u.Path != "":
+		network, raddr = "unixgram", u.Path
+	}
+	w, err := syslog.Dial(network, raddr, facility|severity, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) WriteLine(line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package daemon
+
+import (
+	"errors"
+	"net/url"
+)
+
+func newSyslogSink(u *url.URL, name string) (lineSink, error) {
+	return nil, errors.New("syslog sink is not supported in windows")
+}
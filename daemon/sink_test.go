@@ -0,0 +1,170 @@
+package daemon
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnixgramSink(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "sink.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newSinkWriter("unix://"+sock, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello\nwor"))
+	w.Write([]byte("ld\npartial"))
+	w.Close()
+
+	assertDatagrams(t, conn, "hello", "world", "partial")
+}
+
+func TestSyslogSink(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newSinkWriter("syslog://"+sock+"?facility=local3&tag=myapp", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("hello syslog\n"))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	/* local3(19)<<3 | info(6) = 158 */
+	if !strings.HasPrefix(msg, "<158>") || !strings.Contains(msg, "myapp") || !strings.Contains(msg, "hello syslog") {
+		t.Fatalf("unexpected syslog message %q", msg)
+	}
+}
+
+func TestTCPSinkReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	w, err := newSinkWriter("tcp://"+addr+"?buffer=16", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("line1\n"))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if line, _ := r.ReadString('\n'); line != "line1\n" {
+		t.Fatalf("unexpected line %q", line)
+	}
+
+	/* peer goes away, sink should reconnect and keep shipping */
+	conn.Close()
+	go func() {
+		for i := 0; i < 50; i++ {
+			w.Write([]byte("line2\n"))
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ln.Close()
+	r = bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "line2\n" {
+			return
+		}
+	}
+}
+
+func TestTCPSinkBoundedBuffer(t *testing.T) {
+	/* nobody listens here, writes must never block */
+	w, err := newSinkWriter("tcp://127.0.0.1:1?buffer=2", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			w.Write([]byte("drop me\n"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("tcp sink blocked on full buffer")
+	}
+	w.Close()
+}
+
+func TestTCPSinkStalledPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	/* peer accepts but never reads */
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			time.Sleep(10 * time.Second)
+		}
+	}()
+	w, err := newSinkWriter("tcp://"+ln.Addr().String(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 64*1024) + "\n")
+	for i := 0; i < 512; i++ {
+		w.Write(line)
+	}
+	start := time.Now()
+	w.Close()
+	if elapsed := time.Since(start); elapsed > tcpSinkCloseTimeout+time.Second {
+		t.Fatalf("close should not hang on stalled peer, took %v", elapsed)
+	}
+}
+
+func assertDatagrams(t *testing.T, conn net.PacketConn, expect ...string) {
+	buf := make([]byte, 1024)
+	for _, e := range expect {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != e {
+			t.Fatalf("expect %q got %q", e, got)
+		}
+	}
+}
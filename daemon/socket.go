@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+type ownedSocket struct {
+	ln   net.Listener
+	file *os.File
+}
+
+// socketRegistry owns listening sockets declared by processes, a socket is opened once and
+// kept across process restarts and config reloads until no process declares it
+type socketRegistry struct {
+	mu      sync.Mutex
+	sockets map[string]*ownedSocket
+}
+
+var sockets = newSocketRegistry()
+
+func newSocketRegistry() *socketRegistry {
+	return &socketRegistry{sockets: make(map[string]*ownedSocket)}
+}
+
+// Files returns listening socket files of addrs in order, sockets are opened on first use
+func (r *socketRegistry) Files(addrs []string) ([]*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var files []*os.File
+	for _, addr := range addrs {
+		s, ok := r.sockets[addr]
+		if !ok {
+			var err error
+			if s, err = openSocket(addr); err != nil {
+				return nil, err
+			}
+			logger.Log("listen socket %s", addr)
+			r.sockets[addr] = s
+		}
+		files = append(files, s.file)
+	}
+	return files, nil
+}
+
+// Retain closes sockets not in addrs
+func (r *socketRegistry) Retain(addrs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keep := make(map[string]bool)
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	for addr, s := range r.sockets {
+		if !keep[addr] {
+			logger.Log("close socket %s", addr)
+			s.file.Close()
+			s.ln.Close()
+			delete(r.sockets, addr)
+		}
+	}
+}
+
+func (r *socketRegistry) Close() {
+	r.Retain(nil)
+}
+
+// Listeners returns opened sockets by address
+func (r *socketRegistry) Listeners() map[string]net.Listener {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make(map[string]net.Listener)
+	for addr, s := range r.sockets {
+		list[addr] = s.ln
+	}
+	return list
+}
+
+// Inherit registers socket of addr opened by previous supervisord
+func (r *socketRegistry) Inherit(addr string, ln net.Listener) {
+	file, err := ln.(interface{ File() (*os.File, error) }).File()
+	if err != nil {
+		logger.Log("take over socket %s fail %v", addr, err)
+		ln.Close()
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sockets[addr] = &ownedSocket{ln: ln, file: file}
+}
+
+func openSocket(addr string) (*ownedSocket, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	var ln net.Listener
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		ln, err = net.Listen(u.Scheme, u.Host)
+	case "unix":
+		/* remove stale socket file left by previous run */
+		if fi, err := os.Lstat(u.Path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(u.Path)
+		}
+		ln, err = net.Listen("unix", u.Path)
+	default:
+		return nil, fmt.Errorf("unsupported socket %s", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	/* File returns a dup of listening fd, both are kept open until the socket is released */
+	file, err := ln.(interface{ File() (*os.File, error) }).File()
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &ownedSocket{ln: ln, file: file}, nil
+}
+
+/* $0 is original argv[0], $1 the program path */
+const socketWrapper = `export LISTEN_PID=$$; (exec -a sh true) 2>/dev/null && exec -a "$0" "$@"; exec "$@"`
+
+// attachSockets passes declared sockets to cmd by fd 3.. in declared order following systemd socket
+// activation convention, LISTEN_PID is set by a /bin/sh wrapper since the pid is unknown before exec,
+// the wrapper keeps argv[0] by exec -a where the shell supports it (dash does not)
+func (p *Process) attachSockets(cmd *exec.Cmd) error {
+	if len(p.config.Sockets) == 0 {
+		return nil
+	}
+	files, err := sockets.Files(p.config.Sockets)
+	if err != nil {
+		return err
+	}
+	cmd.ExtraFiles = files
+	cmd.Env = append(cmd.Env, fmt.Sprintf("LISTEN_FDS=%d", len(files)))
+	cmd.Args = append([]string{"/bin/sh", "-c", socketWrapper, cmd.Args[0], cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
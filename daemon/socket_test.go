@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestSocketActivation(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	sock := filepath.Join(dir, "app.sock")
+	cnf := (&config.ProcessConfig{
+		Name:    "activated",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `echo "$LISTEN_FDS $LISTEN_PID $$ $(readlink /proc/$$/fd/3) $(readlink /proc/$$/fd/4)" > "$OUT"; sleep 100`},
+		ENV:     map[string]string{"OUT": out},
+		Stdout:  []string{"/dev/null"},
+		Sockets: []string{"tcp://" + addr, "unix://" + sock},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer sockets.Close()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	data, _ := os.ReadFile(out)
+	fields := strings.Fields(string(data))
+	if len(fields) != 5 || fields[0] != "2" || fields[1] != fields[2] || !strings.HasPrefix(fields[3], "socket:") || !strings.HasPrefix(fields[4], "socket:") {
+		t.Fatalf("bad activation env %q", data)
+	}
+
+	/* sockets keep listening while process is stopped */
+	p.Stop(false)
+	for _, target := range [][2]string{{"tcp", addr}, {"unix", sock}} {
+		conn, err := net.Dial(target[0], target[1])
+		if err != nil {
+			t.Fatalf("socket %s closed after stop: %v", target[1], err)
+		}
+		conn.Close()
+	}
+	sockets.Retain(nil)
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("released socket should be closed")
+	}
+}
+
+func TestSocketActivationPid(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "pid")
+	cnf := (&config.ProcessConfig{
+		Name:    "activated-pid",
+		Command: "sh",
+		Args:    []string{"-c", `echo "$LISTEN_PID $$ $0" > "$OUT"; sleep 100`},
+		ENV:     map[string]string{"OUT": out},
+		Stdout:  []string{"/dev/null"},
+		Sockets: []string{"tcp://127.0.0.1:0"},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer sockets.Close()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	data, _ := os.ReadFile(out)
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 || fields[0] != fields[1] {
+		t.Fatalf("LISTEN_PID does not match pid %q", data)
+	}
+	/* argv[0] is kept only where /bin/sh supports exec -a */
+	if exec.Command("/bin/sh", "-c", "exec -a sh true").Run() == nil && fields[2] != "sh" {
+		t.Fatalf("argv[0] not kept %q", data)
+	}
+}
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+
+	myhttp "github.com/qjpcpu/http"
+	"github.com/qjpcpu/supervisord/config"
+	"github.com/qjpcpu/supervisord/signals"
+)
+
+const (
+	stopStepHTTPTimeout = 10 * time.Second
+	stopPollInterval    = 100 * time.Millisecond
+)
+
+// stopSequence returns steps to stop process, default is stop_signal, wait stop_wait_secs then KILL
+func (p *Process) stopSequence(stopImediately bool) []config.StopStep {
+	kill := config.StopStep{Kind: config.StopStepSignal, Text: config.DefaultKillSignal, SigName: config.DefaultKillSignal, Signal: syscall.SIGKILL}
+	if stopImediately {
+		return []config.StopStep{kill}
+	}
+	if len(p.config.StopSequence) > 0 {
+		steps, err := config.ParseStopSequence(p.config.StopSequence)
+		if err == nil && len(steps) > 0 {
+			return steps
+		}
+		logger.Log("parse stop_sequence of %s fail %v, use default", p.config.Name, err)
+	}
+	sig := p.config.StopSignal
+	if sig == "" {
+		sig = config.DefaultStopSignal
+	}
+	ossig, err := signals.ToSignal(sig)
+	if err != nil {
+		logger.Log("parse signal fail %v", err.Error())
+		ossig, sig = syscall.SIGTERM, config.DefaultStopSignal
+	}
+	wait := time.Duration(firstPositive(p.config.StopWaitSecs, config.DefaultStopWaitSecs)) * time.Second
+	return []config.StopStep{
+		{Kind: config.StopStepSignal, Text: sig, SigName: sig, Signal: ossig},
+		{Kind: config.StopStepWait, Text: fmt.Sprintf("wait %v", wait), Wait: wait},
+		kill,
+	}
+}
+
+// runStopSequence runs steps until process halts, KILL is sent if process survives all steps
+func (p *Process) runStopSequence(steps []config.StopStep) {
+	var current string
+	for i, step := range steps {
+		if !p.isRunning() {
+			break
+		}
+		if step.Kind != config.StopStepWait {
+			current = fmt.Sprintf("step %d/%d %s", i+1, len(steps), step)
+			p.stopReason = current
+		}
+		start := time.Now()
+		switch step.Kind {
+		case config.StopStepSignal:
+			if cmd := p.command(); cmd != nil && cmd.Process != nil {
+				logger.Log("send signal %s to process %s", step.SigName, p.config.Name)
+				signals.Kill(cmd.Process, step.Signal, true)
+			}
+		case config.StopStepHTTP:
+			logger.Log("send %s %s for process %s", step.Method, step.URL, p.config.Name)
+			if err := stopStepRequest(step.Method, step.URL); err != nil {
+				logger.Log("stop step %s of process %s fail %v", step, p.config.Name, err)
+			}
+		case config.StopStepExec:
+			p.runHook("stop_sequence", step.Command)
+		case config.StopStepWait:
+			for time.Since(start) < step.Wait && p.isRunning() {
+				time.Sleep(stopPollInterval)
+			}
+		}
+		if !p.isRunning() {
+			logger.Log("process %s is halt by %s %s later", p.config.Name, current, time.Since(start).Truncate(time.Millisecond))
+			return
+		}
+	}
+	if last := steps[len(steps)-1]; last.Kind == config.StopStepSignal && last.Signal == syscall.SIGKILL {
+		return
+	}
+	if cmd := p.command(); p.isRunning() && cmd != nil && cmd.Process != nil {
+		p.stopReason = "KILL after stop_sequence"
+		logger.Log("process %s survived stop_sequence, send signal %s", p.config.Name, `KILL`)
+		signals.Kill(cmd.Process, syscall.SIGKILL, true)
+	}
+}
+
+// stopTree stops descendants left by stop sequence with its first signal, KILL is sent after stopwaitsecs
+func (p *Process) stopTree(steps []config.StopStep) {
+	sig := syscall.SIGKILL
+	for _, step := range steps {
+		if s, ok := step.Signal.(syscall.Signal); ok && step.Kind == config.StopStepSignal {
+			sig = s
+			break
+		}
+	}
+	wait := time.Duration(firstPositive(p.config.StopWaitSecs, config.DefaultStopWaitSecs)) * time.Second
+	if sig == syscall.SIGKILL {
+		wait = 0
+	}
+	tree.stopTree(p, sig, wait)
+}
+
+func stopStepRequest(method, url string) error {
+	return myhttp.NewClient().
+		SetTimeout(stopStepHTTPTimeout).
+		Do(context.Background(), method, url, nil).
+		HandleResult(func(res *http.Response) error {
+			io.Copy(io.Discard, res.Body)
+			if res.StatusCode < 200 || res.StatusCode >= 300 {
+				return fmt.Errorf("status %s", res.Status)
+			}
+			return nil
+		})
+}
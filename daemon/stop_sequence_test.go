@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestStopSequence(t *testing.T) {
+	var drained int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&drained, 1)
+	}))
+	defer srv.Close()
+
+	cnf := (&config.ProcessConfig{
+		Name:         "stubborn",
+		Command:      "/bin/sh",
+		Args:         []string{"-c", `trap "" TERM; trap "exit 0" USR2; while true; do sleep 0.1; done`},
+		Stdout:       []string{"/dev/null"},
+		StopSequence: []string{"http " + srv.URL + "/drain", "TERM", "wait 300ms", "USR2", "wait 5s", "KILL"},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	ch, cancel := events.Subscribe(EventFilter{Names: []string{"stubborn"}, Types: []string{"STOPPED"}}, 1)
+	defer cancel()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	p.Stop(false)
+
+	select {
+	case e := <-ch:
+		if !strings.Contains(e.Message, "step 4/6 USR2") {
+			t.Fatalf("process should be stopped by USR2, got %q", e.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no STOPPED event")
+	}
+	if atomic.LoadInt32(&drained) != 1 {
+		t.Fatal("drain url not requested")
+	}
+}
@@ -0,0 +1,230 @@
+package daemon
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	chans "github.com/qjpcpu/channel"
+	"github.com/qjpcpu/supervisord/reaper"
+)
+
+/* how often descendants are attributed, a faster fork and exit is attributed by group or session only */
+var treeScanInterval = time.Second
+
+// processTree attributes descendants to managed processes while supervisord is child subreaper, orphans
+// of a process are reparented to supervisord instead of init so they can be stopped with the process
+type processTree struct {
+	mu        sync.Mutex
+	enabled   bool
+	processes map[*Process]struct{}
+	members   map[int]*treeMember
+	groups    map[int]*Process /* process group or session led by a leader which may be gone */
+	stopChan  chans.StopChan
+}
+
+type treeMember struct {
+	owner     *Process
+	startTime uint64
+	zombie    bool
+	orphan    bool /* parent exited, it is reparented to supervisord */
+}
+
+var tree = &processTree{processes: make(map[*Process]struct{})}
+
+// Start makes supervisord child subreaper and scans process tree periodically
+func (t *processTree) Start() error {
+	if err := setChildSubreaper(); err != nil {
+		return err
+	}
+	t.Stop()
+	t.mu.Lock()
+	t.enabled = true
+	t.members = make(map[int]*treeMember)
+	t.groups = make(map[int]*Process)
+	t.stopChan = chans.NewStopChan()
+	go t.run(t.stopChan)
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *processTree) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopChan != nil {
+		t.stopChan.Stop()
+		t.stopChan = nil
+	}
+	t.enabled = false
+}
+
+func (t *processTree) run(stopChan chans.StopChan) {
+	ticker := time.NewTicker(treeScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.scan()
+		case <-stopChan.C():
+			return
+		}
+	}
+}
+
+func (t *processTree) add(p *Process) {
+	t.mu.Lock()
+	t.processes[p] = struct{}{}
+	t.mu.Unlock()
+}
+
+func (t *processTree) remove(p *Process) {
+	t.mu.Lock()
+	delete(t.processes, p)
+	for pid, m := range t.members {
+		if m.owner == p {
+			delete(t.members, pid)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// scan attributes every process to the managed process it descends from, by parent, process group or
+// session. Attribution is kept while the process lives, zombie children nobody waits for are reaped
+func (t *processTree) scan() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled {
+		return
+	}
+	self := os.Getpid()
+	procs := listProcs()
+	var selfSID int
+	if info := procs[self]; info != nil {
+		selfSID = info.SID
+	}
+	owners := make(map[int]*Process)
+	for p := range t.processes {
+		if cmd := p.command(); cmd != nil && cmd.Process != nil && procs[cmd.Process.Pid] != nil {
+			pid := cmd.Process.Pid
+			owners[pid], t.groups[pid] = p, p
+		}
+	}
+	for pid, m := range t.members {
+		if info := procs[pid]; info != nil && info.StartTime == m.startTime {
+			owners[pid] = m.owner
+		} else {
+			delete(t.members, pid)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for pid, info := range procs {
+			if pid == self || owners[pid] != nil {
+				continue
+			}
+			owner := owners[info.PPID]
+			if owner == nil {
+				owner = t.groups[info.PGID]
+			}
+			if owner == nil && info.SID != selfSID {
+				if owner = owners[info.SID]; owner == nil {
+					owner = t.groups[info.SID]
+				}
+			}
+			if owner != nil {
+				owners[pid] = owner
+				t.members[pid] = &treeMember{owner: owner, startTime: info.StartTime}
+				changed = true
+			}
+		}
+	}
+	used := make(map[int]bool)
+	for pid, m := range t.members {
+		info := procs[pid]
+		used[info.PGID], used[info.SID] = true, true
+		m.zombie = info.State == 'Z'
+		m.orphan = owners[info.PPID] != m.owner
+		if m.zombie && info.PPID == self && reaper.ReapOrphan(pid) {
+			delete(t.members, pid)
+		}
+	}
+	/* unattributed orphans are reaped too, they stay zombies otherwise unless reap_zombie = true */
+	for pid, info := range procs {
+		if info.State == 'Z' && info.PPID == self && owners[pid] == nil {
+			reaper.ReapOrphan(pid)
+		}
+	}
+	for id, p := range t.groups {
+		if _, ok := t.processes[p]; !ok || (!used[id] && procs[id] == nil) {
+			delete(t.groups, id)
+		}
+	}
+}
+
+// descendants returns live processes attributed to p, orphans only if orphan is true
+func (t *processTree) descendants(p *Process, orphan bool) []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list []int
+	for pid, m := range t.members {
+		if m.owner == p && !m.zombie && (m.orphan || !orphan) {
+			list = append(list, pid)
+		}
+	}
+	sort.Ints(list)
+	return list
+}
+
+func (t *processTree) isEnabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.enabled
+}
+
+// stopTree stops descendants of p which survive its stop sequence, e.g. those left their process group
+// by setsid, they get sig and KILL if still running after wait
+func (t *processTree) stopTree(p *Process, sig syscall.Signal, wait time.Duration) {
+	if !t.isEnabled() {
+		return
+	}
+	t.scan()
+	pids := t.descendants(p, false)
+	if len(pids) == 0 {
+		return
+	}
+	logger.Log("send signal %v to %d descendants of process %s %v", sig, len(pids), p.config.Name, pids)
+	for _, pid := range pids {
+		syscall.Kill(pid, sig)
+	}
+	for start := time.Now(); time.Since(start) < wait && len(pids) > 0; {
+		time.Sleep(stopPollInterval)
+		t.scan()
+		pids = t.descendants(p, false)
+	}
+	if len(pids) > 0 {
+		logger.Log("descendants of process %s survived, send signal KILL %v", p.config.Name, pids)
+		for _, pid := range pids {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+		time.Sleep(stopPollInterval)
+	}
+	t.scan()
+}
+
+func listProcs() map[int]*procInfo {
+	entries, _ := os.ReadDir("/proc")
+	procs := make(map[int]*procInfo, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if info, err := readProcInfo(pid); err == nil {
+			procs[pid] = info
+		}
+	}
+	return procs
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "errors"
+
+func setChildSubreaper() error {
+	return errors.New("subreaper is only supported on linux")
+}
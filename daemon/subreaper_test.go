@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestSubreaperStopTree(t *testing.T) {
+	if err := tree.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer tree.Stop()
+	dir := t.TempDir()
+	/* the helper leaves process group by setsid */
+	cnf := (&config.ProcessConfig{
+		Name:    "forker",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `setsid sleep 100 & echo $! > ` + filepath.Join(dir, "helper") + `; exec sleep 100`},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	time.Sleep(300 * time.Millisecond)
+	data, _ := os.ReadFile(filepath.Join(dir, "helper"))
+	helper, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.scan()
+	if got := tree.descendants(p, false); len(got) != 1 || got[0] != helper {
+		t.Fatalf("helper should be attributed to process, got %v", got)
+	}
+	if len(p.GetState().Orphans) != 0 {
+		t.Fatal("helper is not orphan while its parent runs")
+	}
+
+	/* parent exits alone, helper is reparented to us */
+	syscall.Kill(p.command().Process.Pid, syscall.SIGKILL)
+	time.Sleep(300 * time.Millisecond)
+	tree.scan()
+	if ppid, _, _ := procStat(helper); ppid != os.Getpid() {
+		t.Fatalf("orphan should be reparented to subreaper, ppid %d", ppid)
+	}
+	if got := p.GetState().Orphans; len(got) != 1 || got[0] != helper {
+		t.Fatalf("orphan should be reported, got %v", got)
+	}
+
+	p.Stop(false)
+	if _, _, err := procStat(helper); err == nil {
+		t.Fatal("orphan should be stopped and reaped with its process")
+	}
+	if len(p.GetState().Orphans) != 0 {
+		t.Fatal("no orphan should be left")
+	}
+}
+
+func TestSubreaperReapOrphanZombie(t *testing.T) {
+	if err := tree.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer tree.Stop()
+	/* orphan belongs to no process, it is reparented to us and exits */
+	out, err := exec.Command("setsid", "/bin/sh", "-c", "sleep 0.2 & echo $!").Output()
+	if err != nil {
+		t.Skip(err)
+	}
+	orphan, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if ppid, _, _ := procStat(orphan); ppid != os.Getpid() {
+		t.Fatalf("orphan should be reparented to subreaper, ppid %d", ppid)
+	}
+	tree.scan()
+	if _, _, err := procStat(orphan); err == nil {
+		t.Fatal("zombie orphan should be reaped")
+	}
+}
@@ -4,12 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"sort"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	chans "github.com/qjpcpu/channel"
@@ -30,6 +28,16 @@ type Supervisord struct {
 	processDone  *sync.Map
 	processMutex *sync.RWMutex
 	processExit  chan bool
+	janitor      *logJanitor
+	webhooks     *webhookManager
+	configWatch  *configWatcher
+	stateFile    string
+	stateCancel  func()
+	adoptions    map[string]*processRecord
+	idle         map[string]string
+	exitMu       sync.Mutex
+	exitCode     *int
+	failure      *int /* exit code of first failed process */
 }
 
 type StopOption struct {
@@ -45,14 +53,32 @@ func (s *Supervisord) Start() error {
 	ctx := context.Background()
 	cnf := config.Provider().GetConfig()
 	initLogger(cnf.Log)
-	if cnf.ReapZombie {
+	takeOverUpgrade()
+	/* zombies are always reaped by pid 1 */
+	if cnf.ReapZombie || os.Getpid() == 1 {
 		reaper.ReapZombie()
 	}
+	if cnf.Subreaper {
+		if err := tree.Start(); err != nil {
+			logger.Log("enable subreaper fail %v", err)
+		}
+	}
 	s.setenv(cnf)
+	s.webhooks.Reload(cnf.Notify)
+	if cnf.KeepChildren {
+		s.stateFile = cnf.StateFilePath()
+		s.loadState()
+	}
 	if err := s.StartAll(ctx, true); err != nil {
 		return err
 	}
+	if s.stateFile != "" {
+		s.finishRestore()
+		s.keepState()
+	}
 	s.admin.Start()
+	s.janitor.Start()
+	s.configWatch.Reload(cnf)
 	<-s.stopChan.C()
 	return nil
 }
@@ -64,12 +90,11 @@ func (s *Supervisord) StartProcess(ctx context.Context, name string) error {
 	if !ok {
 		return fmt.Errorf("process %s no exist", name)
 	}
-	if st := p.GetState().State; st == Running || st == Starting {
+	if p.GetState().State.Active() {
 		return fmt.Errorf("Error: %s is running", name)
 	}
-	p.Start()
 	s.processDone.Delete(name)
-	return nil
+	return p.Start()
 }
 
 func (s *Supervisord) OmitProcessExitCode(ctx context.Context, name string) error {
@@ -119,21 +144,69 @@ func (s *Supervisord) RestartProcess(ctx context.Context, name string) error {
 		return fmt.Errorf("process %s no exist", name)
 	}
 	p.Stop(false)
-	p.Start()
 	s.processDone.Delete(name)
-	return nil
+	return p.Start()
+}
+
+// RunProcessNow triggers a run of scheduled or oneshot process
+func (s *Supervisord) RunProcessNow(ctx context.Context, name string) error {
+	s.processMutex.RLock()
+	p, ok := s.processMap[name]
+	s.processMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("process %s no exist", name)
+	}
+	s.processDone.Delete(name)
+	return p.RunNow()
+}
+
+// PauseProcess freezes process by SIGSTOP, resume it by ResumeProcess
+func (s *Supervisord) PauseProcess(ctx context.Context, name string) error {
+	s.processMutex.RLock()
+	defer s.processMutex.RUnlock()
+	p, ok := s.processMap[name]
+	if !ok {
+		return fmt.Errorf("process %s no exist", name)
+	}
+	return p.Pause()
+}
+
+func (s *Supervisord) ResumeProcess(ctx context.Context, name string) error {
+	s.processMutex.RLock()
+	defer s.processMutex.RUnlock()
+	p, ok := s.processMap[name]
+	if !ok {
+		return fmt.Errorf("process %s no exist", name)
+	}
+	return p.Resume()
+}
+
+// SignalReloadProcess makes process reload in place by its reload_signal
+func (s *Supervisord) SignalReloadProcess(ctx context.Context, name string) error {
+	s.processMutex.RLock()
+	p, ok := s.processMap[name]
+	s.processMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("process %s no exist", name)
+	}
+	return p.SignalReload(ctx)
 }
 
 func (s *Supervisord) IsAllProcessDone(ctx context.Context) bool {
 	s.processMutex.RLock()
 	defer s.processMutex.RUnlock()
-	var count int
-	for name := range s.processMap {
+	var count, total int
+	for name, p := range s.processMap {
+		/* never started manual processes are not accounted */
+		if !p.config.IsAutostart() && p.GetState().State == WaitSchedule {
+			continue
+		}
+		total++
 		if _, ok := s.processDone.Load(name); ok {
 			count++
 		}
 	}
-	return count == len(s.processMap)
+	return count == total
 }
 
 func (s *Supervisord) StartAll(ctx context.Context, includeFinished bool) error {
@@ -162,6 +235,10 @@ func (s *Supervisord) Reload() error {
 	ctx := context.Background()
 	doneFlags := new(sync.Map)
 	s.processDone.Range(func(key, value interface{}) bool { doneFlags.Store(key, value); return true })
+	oldNames := make(map[string]bool)
+	for name := range s.processMap {
+		oldNames[name] = true
+	}
 	s.stopAll(ctx, false)
 
 	cnf, err := config.Provider().ReloadConfig()
@@ -170,18 +247,47 @@ func (s *Supervisord) Reload() error {
 	}
 	s.admin.Reload(cnf.AdminListenAddr())
 	s.setenv(cnf)
+	s.webhooks.Reload(cnf.Notify)
+	s.configWatch.Reload(cnf)
 	s.processDone = doneFlags
 	s.startAll(ctx, false)
+	s.retainSockets()
+	for name := range s.processMap {
+		if !oldNames[name] {
+			events.Publish(&Event{Type: EventProcessAdded, Name: name})
+		}
+		delete(oldNames, name)
+	}
+	for name := range oldNames {
+		events.Publish(&Event{Type: EventProcessRemoved, Name: name})
+	}
+	events.Publish(&Event{Type: EventConfigReloaded})
 	return nil
 }
 
+// CheckAndReload reloads config only if config file is valid, running state is kept otherwise
+func (s *Supervisord) CheckAndReload() error {
+	if err := config.Provider().CheckConfigFile(); err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
 func (s *Supervisord) Stop(option StopOption) {
 	s.processMutex.Lock()
 	defer s.processMutex.Unlock()
 	ctx := context.Background()
 	logger.Log("terminating all process and supervisord, option %s", option.String())
-	s.stopAll(ctx, option.StopImmediately)
+	s.shutdownAll(ctx, option.StopImmediately, time.Duration(config.Provider().GetConfig().ShutdownDeadlineSecs)*time.Second)
 	logger.Log("all process terminated")
+	tree.Stop()
+	if s.stateFile != "" {
+		s.clearState()
+	}
+	s.janitor.Stop()
+	s.webhooks.Stop()
+	s.configWatch.Stop()
+	sockets.Close()
 	s.admin.Stop()
 	if option.ClearLog {
 		logger.Close()
@@ -190,6 +296,19 @@ func (s *Supervisord) Stop(option StopOption) {
 	s.stopChan.Stop()
 }
 
+// retainSockets releases sockets no longer declared by any process
+func (s *Supervisord) retainSockets() {
+	var addrs []string
+	for _, p := range s.processMap {
+		addrs = append(addrs, p.config.Sockets...)
+	}
+	sockets.Retain(addrs)
+}
+
+func (s *Supervisord) GetLogUsage() LogUsage {
+	return s.janitor.Usage()
+}
+
 func (s *Supervisord) GetProcessList() (list []*Process) {
 	s.processMutex.RLock()
 	defer s.processMutex.RUnlock()
@@ -197,6 +316,9 @@ func (s *Supervisord) GetProcessList() (list []*Process) {
 		list = append(list, s.processMap[name])
 	}
 	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].createTime == list[j].createTime {
+			return list[i].config.Name < list[j].config.Name
+		}
 		return list[i].createTime < list[j].createTime
 	})
 	return
@@ -206,8 +328,13 @@ func (s *Supervisord) AddProc(ctx context.Context, addProc *config.AddProcConfig
 	s.processMutex.Lock()
 	defer s.processMutex.Unlock()
 	proc := addProc.ProcessConfig
+	if err := proc.Validate(); err != nil {
+		return err
+	}
 	if p := s.processMap[proc.Name]; p != nil {
 		p.Shutdown(false)
+	} else {
+		events.Publish(&Event{Type: EventProcessAdded, Name: proc.Name})
 	}
 
 	prov := config.Provider()
@@ -215,11 +342,21 @@ func (s *Supervisord) AddProc(ctx context.Context, addProc *config.AddProcConfig
 	gconf.AddProcessConfig(proc)
 	prov.UpdateConfig(gconf)
 
-	s.processMap[proc.Name] = NewProcess(proc, func(byuser bool) {
-		s.processDone.Store(proc.Name, struct{}{})
+	s.processMap[proc.Name] = s.newProcess(proc)
+	return s.processMap[proc.Name].Start()
+}
+
+func (s *Supervisord) newProcess(cnf *config.ProcessConfig) *Process {
+	name := cnf.Name
+	p := NewProcess(cnf, func(byuser bool) {
+		s.processDone.Store(name, struct{}{})
 		s.processExit <- byuser
 	})
-	return s.processMap[proc.Name].Start()
+	p.failed = func(code int) { s.processFailed(p, code) }
+	if s.stateFile != "" {
+		p.keepChildren(s.fifoDir())
+	}
+	return p
 }
 
 func (s *Supervisord) startAll(ctx context.Context, includeFinished bool) error {
@@ -229,20 +366,34 @@ func (s *Supervisord) startAll(ctx context.Context, includeFinished bool) error
 	for _, p := range cnf.Process {
 		name := p.Name
 		if pro := s.processMap[name]; pro != nil {
-			if st := pro.GetState().State; st == Running || st == Starting {
+			if pro.GetState().State.Active() {
 				return fmt.Errorf("Error: %s is running", name)
 			}
 			pro.Shutdown(false)
 		}
-		s.processMap[name] = NewProcess(p, func(byuser bool) {
-			s.processDone.Store(name, struct{}{})
-			s.processExit <- byuser
-		})
+		s.processMap[name] = s.newProcess(p)
+		if rec := s.takeAdoption(p); rec != nil {
+			err := s.processMap[name].Adopt(rec)
+			if err == nil {
+				continue
+			}
+			terminateStale(rec, fmt.Sprintf("adopt fail %v", err))
+		}
+		if s.restoreIdle(name) {
+			continue
+		}
 		if _, ok := alreadyDone.Load(name); ok && !includeFinished {
 			s.processDone.Store(name, struct{}{})
 			continue
 		}
-		s.processMap[p.Name].Start()
+		switch pro := s.processMap[name]; {
+		case !p.IsAutostart():
+			logger.Log("process %s autostart is off, wait for manual start", name)
+		case p.StartDelay > 0:
+			pro.StartDelayed(time.Duration(p.StartDelay) * time.Second)
+		default:
+			pro.Start()
+		}
 	}
 	return nil
 }
@@ -266,6 +417,9 @@ func Get() *Supervisord {
 			processDone:  new(sync.Map),
 			processExit:  make(chan bool, 1),
 		}
+		s.janitor = newLogJanitor(s.collectLogFiles)
+		s.webhooks = newWebhookManager()
+		s.configWatch = newConfigWatcher(s.CheckAndReload)
 		installSignals(s)
 		singleton = s
 	})
@@ -274,19 +428,19 @@ func Get() *Supervisord {
 
 func installSignals(s *Supervisord) {
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigs, policySignals()...)
 	go func() {
 		for {
 			select {
 			case sig := <-sigs:
-				logger.Log("receive signal %v", sig)
-				s.Stop(StopOption{})
-				os.Exit(-1)
+				/* Start returns once stopped, ExitCode tells why */
+				if s.handleSignal(sig) {
+					return
+				}
 			case byuser := <-s.processExit:
 				cnf := config.Provider().GetConfig()
 				if cnf.ExitWhenAllProcessDone && s.IsAllProcessDone(context.Background()) && !byuser {
-					logger.Log("all process exited, supervisord would exit too")
-					s.Stop(StopOption{})
+					s.exitAllDone()
 					return
 				}
 			}
@@ -295,36 +449,42 @@ func installSignals(s *Supervisord) {
 }
 
 func (s *Supervisord) clearLogs() {
-	files := s.collectPurgeFiles()
-	if len(files) == 0 {
-		return
-	}
-	wg := new(sync.WaitGroup)
-	for i := range files {
-		file := files[i]
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := exec.Command("bash", "-c", fmt.Sprintf("rm -fr %v", file)).Run(); err != nil {
-				fmt.Printf("[%s] remove log %v fail %v\n", time.Now().Format(`2006-01-02 15:04:05`), file, err)
-			} else {
-				fmt.Printf("[%s] remove log %v success\n", time.Now().Format(`2006-01-02 15:04:05`), file)
-			}
-		}()
+	if err := PurgeLogs(false, os.Stdout); err != nil {
+		fmt.Printf("[%s] purge logs %v\n", time.Now().Format(`2006-01-02 15:04:05`), err)
 	}
-	wg.Wait()
+}
+
+func (s *Supervisord) collectLogFiles() []string {
+	return collectLogFiles(config.Provider().GetConfig())
 }
 
 func (s *Supervisord) collectPurgeFiles() []string {
-	conf := config.Provider().GetConfig()
-	appendStar := func(s []string) []string {
-		return fp.StreamOf(s).
-			Reject(func(v string) bool {
-				return v == "" || v == "/"
-			}).
-			Map(func(v string) string { return v + "*" }).
-			Strings()
-	}
+	return collectPurgeFiles(config.Provider().GetConfig())
+}
+
+// collectLogFiles returns patterns of log files written by supervisord and its processes with their rotations
+func collectLogFiles(conf *config.SupervisorConfig) []string {
+	return fp.StreamOf(conf.Process).
+		FlatMap(func(c *config.ProcessConfig) []string {
+			return append(logPatterns(c.Stdout), logPatterns(c.Stderr)...)
+		}).
+		Union(fp.StreamOf(logPatterns([]string{conf.Log}))).
+		Uniq().
+		Strings()
+}
+
+/* log file path with its rotations, sinks and devices are not files */
+func logPatterns(s []string) []string {
+	return fp.StreamOf(s).
+		Reject(func(v string) bool {
+			return v == "" || v == "/" || isURLSink(v) || strings.HasPrefix(v, "/dev/")
+		}).
+		Map(func(v string) string { return v + "*" }).
+		Strings()
+}
+
+func collectPurgeFiles(conf *config.SupervisorConfig) []string {
+	appendStar := logPatterns
 	rewritePurgeFiles := func(fs []string) (ret []string) {
 		for _, item := range fs {
 			if strings.HasSuffix(item, "/") {
@@ -0,0 +1,279 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+	"github.com/qjpcpu/supervisord/reaper"
+	"github.com/qjpcpu/supervisord/sys"
+)
+
+/* set for supervisord exec'ed by upgrade, fds are kept open across exec */
+const (
+	envUpgrade   = "SUPERVISORD_UPGRADE"
+	envAdminFD   = "SUPERVISORD_ADMIN_FD"
+	envSocketFDs = "SUPERVISORD_SOCKET_FDS"
+)
+
+const selfCheckTimeout = 10 * time.Second
+
+/* time given to admin server to send upgrade response before exec */
+var upgradeExecDelay = 200 * time.Millisecond
+
+// upgradeGate is held by upgrade from handing over fds to exec, children are started under its read lock so
+// none of them is missed in saved state or inherits handed over fds
+var upgradeGate sync.RWMutex
+
+// startCommand starts a child of supervisord, it waits while upgrade is in progress
+func startCommand(cmd *exec.Cmd) error {
+	upgradeGate.RLock()
+	defer upgradeGate.RUnlock()
+	return reaper.StartCommand(cmd)
+}
+
+var adminListener struct {
+	sync.Mutex
+	ln        net.Listener
+	inherited net.Listener
+}
+
+// IsUpgrade reports whether this supervisord is exec'ed by upgrade of a running one
+func IsUpgrade() bool {
+	return os.Getenv(envUpgrade) != ""
+}
+
+// Upgrade replaces running supervisord by binary without stopping processes, binary defaults to current
+// executable which may be replaced on disk already. Processes, admin listener and sockets are handed over
+// by exec, nothing is changed if binary fails self check
+func (s *Supervisord) Upgrade(binary string) error {
+	if s.stateFile == "" {
+		return errors.New("upgrade needs keep_children = true, processes are killed with supervisord otherwise")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if binary == "" {
+		binary = exe
+	}
+	conf, err := config.ConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := selfCheck(binary, conf); err != nil {
+		return fmt.Errorf("binary %s fails self check, keep running: %v", binary, err)
+	}
+	rollback, err := installBinary(binary, exe)
+	if err != nil {
+		return err
+	}
+	/* no child is started from now on, so fds handed over are never inherited by them */
+	upgradeGate.Lock()
+	env, release, err := handoverFiles()
+	if err != nil {
+		upgradeGate.Unlock()
+		rollback()
+		return err
+	}
+	logger.Log("upgrade supervisord by %s", binary)
+	go func() {
+		time.Sleep(upgradeExecDelay)
+		if err := s.execUpgrade(exe, env); err != nil {
+			logger.Log("upgrade fail, keep running %v", err)
+			release()
+			upgradeGate.Unlock()
+			rollback()
+		}
+	}()
+	return nil
+}
+
+// execUpgrade saves state and execs exe, it returns only if exec fails. upgradeGate must be held so no
+// child is started after state is saved, a process which exits meanwhile is started again by new supervisord
+func (s *Supervisord) execUpgrade(exe string, env []string) error {
+	if s.stateCancel != nil {
+		s.stateCancel()
+	}
+	s.saveState()
+	argv := append([]string{exe}, sys.Args()[1:]...)
+	err := syscall.Exec(exe, argv, append(os.Environ(), env...))
+	s.keepState()
+	return err
+}
+
+// selfCheck runs `binary selfcheck conf`, which checks binary works and accepts config
+func selfCheck(binary, conf string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary, "selfcheck", conf)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := reaper.StartCommand(cmd)
+	if err == nil {
+		_, err = reaper.WaitCommand(cmd)
+	}
+	if err != nil {
+		return errors.New(strings.TrimSpace(err.Error() + " " + out.String()))
+	}
+	return nil
+}
+
+// installBinary replaces exe by binary, old one is kept as exe.old for rollback
+func installBinary(binary, exe string) (rollback func(), err error) {
+	if abs, _ := filepath.Abs(binary); abs == exe {
+		return func() {}, nil
+	}
+	src, err := os.Open(binary)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(exe+".new", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(exe + ".new")
+		return nil, err
+	}
+	if err := os.Rename(exe, exe+".old"); err != nil {
+		os.Remove(exe + ".new")
+		return nil, err
+	}
+	if err := os.Rename(exe+".new", exe); err != nil {
+		os.Rename(exe+".old", exe)
+		return nil, err
+	}
+	return func() {
+		logger.Log("restore supervisord binary %s", exe)
+		os.Rename(exe+".old", exe)
+	}, nil
+}
+
+// handoverFiles makes admin listener and owned sockets survive exec, it returns env telling their fds
+func handoverFiles() (env []string, release func(), err error) {
+	var files []*os.File
+	release = func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	inheritable := func(ln net.Listener) (uintptr, error) {
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+		fd := f.Fd()
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+			return 0, errno
+		}
+		return fd, nil
+	}
+	adminListener.Lock()
+	ln := adminListener.ln
+	adminListener.Unlock()
+	if ln != nil {
+		fd, err := inheritable(ln)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		env = append(env, fmt.Sprintf("%s=%d", envAdminFD, fd))
+	}
+	var list []string
+	for addr, ln := range sockets.Listeners() {
+		fd, err := inheritable(ln)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		list = append(list, fmt.Sprintf("%s=%d", addr, fd))
+	}
+	env = append(env, envUpgrade+"=1", envSocketFDs+"="+strings.Join(list, ","))
+	return env, release, nil
+}
+
+// takeOverUpgrade takes listeners handed over by previous supervisord, it must run before any process
+// is started so children never inherit them
+func takeOverUpgrade() {
+	if !IsUpgrade() {
+		return
+	}
+	logger.Log("supervisord upgraded, take over processes")
+	if ln := inheritListener(os.Getenv(envAdminFD), "admin"); ln != nil {
+		adminListener.Lock()
+		adminListener.inherited = ln
+		adminListener.Unlock()
+	}
+	for _, item := range strings.Split(os.Getenv(envSocketFDs), ",") {
+		/* addr contains = only in query string, fd is after the last one */
+		if i := strings.LastIndexByte(item, '='); i > 0 {
+			if ln := inheritListener(item[i+1:], item[:i]); ln != nil {
+				sockets.Inherit(item[:i], ln)
+			}
+		}
+	}
+	os.Unsetenv(envUpgrade)
+	os.Unsetenv(envAdminFD)
+	os.Unsetenv(envSocketFDs)
+}
+
+func inheritListener(fdStr, name string) net.Listener {
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), name)
+	/* FileListener dups fd with close-on-exec, the inherited one is closed */
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		logger.Log("take over %s listener fail %v", name, err)
+		return nil
+	}
+	return ln
+}
+
+// listenAdmin listens on admin address, listener handed over by upgrade is used once if any
+func listenAdmin(addr string) (net.Listener, error) {
+	adminListener.Lock()
+	defer adminListener.Unlock()
+	ln := adminListener.inherited
+	adminListener.inherited = nil
+	if ln == nil {
+		var err error
+		if sock, ok := strings.CutPrefix(addr, "unix://"); ok {
+			if sock, err = filepath.Abs(sock); err != nil {
+				return nil, err
+			}
+			os.MkdirAll(filepath.Dir(sock), 0755)
+			os.RemoveAll(sock)
+			ln, err = net.Listen("unix", sock)
+		} else {
+			ln, err = net.Listen("tcp", addr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+	}
+	adminListener.ln = ln
+	return ln, nil
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/reaper"
+)
+
+func TestInstallBinary(t *testing.T) {
+	dir := t.TempDir()
+	exe, binary := filepath.Join(dir, "supervisord"), filepath.Join(dir, "new")
+	os.WriteFile(exe, []byte("old"), 0755)
+	os.WriteFile(binary, []byte("new"), 0755)
+	if err := selfCheck("/bin/false", "supervisord.conf"); err == nil {
+		t.Fatal("failed self check should be reported")
+	}
+	rollback, err := installBinary(binary, exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "new" {
+		t.Fatalf("binary not installed %s", data)
+	}
+	rollback()
+	if data, _ := os.ReadFile(exe); string(data) != "old" {
+		t.Fatalf("binary not rolled back %s", data)
+	}
+}
+
+func TestHandoverAdminListener(t *testing.T) {
+	ln, err := listenAdmin("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	env, release, err := handoverFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	if !IsUpgrade() {
+		t.Fatal("upgrade env should be set")
+	}
+	takeOverUpgrade()
+	if IsUpgrade() {
+		t.Fatal("upgrade env should be cleared after take over")
+	}
+	inherited, err := listenAdmin(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited == ln || inherited.Addr().String() != ln.Addr().String() {
+		t.Fatal("handed over listener should be used")
+	}
+	go func() {
+		if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := inherited.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestRestoreIdle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state")
+	saveState(file, &daemonState{Done: []string{"job"}, Stopped: []string{"web"}})
+	s := &Supervisord{stateFile: file, processDone: new(sync.Map)}
+	s.loadState()
+	if !s.restoreIdle("job") || !s.restoreIdle("web") || s.restoreIdle("other") {
+		t.Fatal("done and stopped processes should be kept")
+	}
+	if _, ok := s.processDone.Load("job"); !ok {
+		t.Fatal("done process should be kept done")
+	}
+	if _, ok := s.processDone.Load("web"); ok {
+		t.Fatal("stopped process should not be done")
+	}
+}
+
+func TestUpgradeGateBlocksStart(t *testing.T) {
+	upgradeGate.Lock()
+	started := make(chan error, 1)
+	cmd := exec.Command("/bin/true")
+	go func() { started <- startCommand(cmd) }()
+	select {
+	case <-started:
+		upgradeGate.Unlock()
+		t.Fatal("command started while upgrade is in progress")
+	case <-time.After(200 * time.Millisecond):
+	}
+	upgradeGate.Unlock()
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	reaper.WaitCommand(cmd)
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestWaitFor(t *testing.T) {
+	dir := t.TempDir()
+	cnf := (&config.ProcessConfig{
+		Name:    "waiter",
+		Command: "/bin/sleep",
+		Args:    []string{"100"},
+		CWD:     dir,
+		Stdout:  []string{"/dev/null"},
+		WaitFor: []string{"file://db.ready", "exec:test -f db.ready"},
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if st := p.GetState(); st.State != Waiting || st.PID != "" {
+		t.Fatalf("process should be waiting, got %+v", st.State)
+	}
+	os.WriteFile(filepath.Join(dir, "db.ready"), nil, 0644)
+	time.Sleep(time.Second)
+	if st := p.GetState(); st.State != Running {
+		t.Fatalf("process should be running, got %v", st.State)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:               "waiter-timeout",
+		Command:            "/bin/sleep",
+		Args:               []string{"100"},
+		Stdout:             []string{"/dev/null"},
+		WaitFor:            []string{"tcp://127.0.0.1:1"},
+		WaitForTimeoutSecs: 1,
+	}).FillDefaults()
+	ch, cancel := events.Subscribe(EventFilter{Names: []string{"waiter-timeout"}, Types: []string{"FATAL"}}, 1)
+	defer cancel()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	start := time.Now()
+	p.Start()
+	select {
+	case <-ch:
+		/* every start attempt waits for timeout */
+		if d := time.Since(start); d < 2*time.Second {
+			t.Fatalf("should fail after %d attempts, got %v", maxStartCount, d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait_for timeout should be fatal")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := p.GetState().State; st != Stopped {
+		t.Fatalf("process should be stopped, got %v", st)
+	}
+}
+
+func TestWaitForPreStartFail(t *testing.T) {
+	cnf := (&config.ProcessConfig{
+		Name:     "waiter-pre-start",
+		Command:  "/bin/sleep",
+		Args:     []string{"100"},
+		Stdout:   []string{"/dev/null"},
+		WaitFor:  []string{"tcp://127.0.0.1:1"},
+		PreStart: "exit 3",
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	defer p.Shutdown(true)
+	if err := p.Start(); err == nil {
+		t.Fatal("failing pre_start should be returned by start")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := p.GetState().State; st != Stopped {
+		t.Fatalf("process should be stopped, got %v", st)
+	}
+}
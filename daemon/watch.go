@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultWatchDebounceMs = 500
+
+// fileWatcher reports changes of files matching watch patterns, changes are coalesced until no
+// further change is seen in debounce interval so a binary being written triggers one restart
+type fileWatcher struct {
+	patterns  []string
+	ignore    []string
+	debounce  time.Duration
+	onChange  func(path string)
+	in        *inotify
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	last  string
+	timer *time.Timer
+}
+
+// newFileWatcher watches parent directories of patterns, a pattern of existing directory
+// matches files directly in it, relative patterns are relative to cwd
+func newFileWatcher(cwd string, patterns, ignore []string, debounce time.Duration, onChange func(string)) (*fileWatcher, error) {
+	w := &fileWatcher{
+		ignore:   ignore,
+		debounce: debounce,
+		onChange: onChange,
+		closed:   make(chan struct{}),
+	}
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(cwd, pattern)
+		}
+		if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+			pattern = filepath.Join(pattern, "*")
+		}
+		w.patterns = append(w.patterns, pattern)
+		/* directory part may be a glob too */
+		matches, _ := filepath.Glob(filepath.Dir(pattern))
+		var watched bool
+		for _, dir := range matches {
+			if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+				watched = true
+				if !seen[dir] {
+					seen[dir] = true
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+		if !watched {
+			logger.Log("[watch] directory of %s does not exist, it is not watched", pattern)
+		}
+	}
+	in, err := newInotify(dirs)
+	if err != nil {
+		return nil, err
+	}
+	w.in = in
+	go w.loop()
+	return w, nil
+}
+
+func (w *fileWatcher) loop() {
+	for {
+		paths, err := w.in.Read()
+		if err != nil {
+			return
+		}
+		for _, path := range paths {
+			if w.match(path) {
+				w.changed(path)
+			}
+		}
+	}
+}
+
+func (w *fileWatcher) match(path string) bool {
+	for _, pattern := range w.ignore {
+		target := path
+		if !strings.Contains(pattern, "/") {
+			target = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return false
+		}
+	}
+	for _, pattern := range w.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fileWatcher) changed(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = path
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, w.fire)
+	} else {
+		w.timer.Reset(w.debounce)
+	}
+}
+
+func (w *fileWatcher) fire() {
+	w.mu.Lock()
+	path := w.last
+	w.mu.Unlock()
+	select {
+	case <-w.closed:
+	default:
+		w.onChange(path)
+	}
+}
+
+func (w *fileWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closed)
+		w.in.Close()
+		w.mu.Lock()
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		w.mu.Unlock()
+	})
+}
+
+// watchFiles restarts process or sends its reload_signal through command queue on file changes
+func (p *Process) watchFiles() {
+	debounce := time.Duration(firstPositive(p.config.WatchDebounceMs, defaultWatchDebounceMs)) * time.Millisecond
+	w, err := newFileWatcher(p.config.CWD, p.config.Watch, p.config.WatchIgnore, debounce, func(path string) {
+		p.sendCmd(&cmdRestart{reason: "change of " + path})
+	})
+	if err != nil {
+		logger.Log("watch files of process %s fail %v", p.config.Name, err)
+		return
+	}
+	p.watcher = w
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+/* atomic replace by rename shows as IN_MOVED_TO, chmod +x after build as IN_ATTRIB */
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+type inotify struct {
+	file *os.File
+	dirs map[int32]string
+	buf  []byte
+}
+
+func newInotify(dirs []string) (*inotify, error) {
+	/* a non-blocking fd is read by runtime poller so Close unblocks Read */
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	in := &inotify{
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int32]string),
+		buf:  make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)),
+	}
+	for _, dir := range dirs {
+		wd, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("watch %s %v", dir, err)
+		}
+		in.dirs[int32(wd)] = dir
+	}
+	return in, nil
+}
+
+// Read blocks until some events arrive and returns paths of changed files
+func (in *inotify) Read() ([]string, error) {
+	n, err := in.file.Read(in.buf)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&in.buf[off]))
+		nameStart := off + syscall.SizeofInotifyEvent
+		off = nameStart + int(ev.Len)
+		name := strings.TrimRight(string(in.buf[nameStart:off]), "\x00")
+		if dir, ok := in.dirs[ev.Wd]; ok && name != "" {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths, nil
+}
+
+func (in *inotify) Close() error {
+	return in.file.Close()
+}
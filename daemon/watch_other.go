@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "errors"
+
+type inotify struct{}
+
+func newInotify(dirs []string) (*inotify, error) {
+	return nil, errors.New("watch is only supported on linux")
+}
+
+func (in *inotify) Read() ([]string, error) {
+	return nil, errors.New("watch is only supported on linux")
+}
+
+func (in *inotify) Close() error {
+	return nil
+}
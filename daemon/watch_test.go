@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestWatchRestart(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "bin"), 0755)
+	out := filepath.Join(dir, "starts")
+	var exits atomic.Int32
+	cnf := (&config.ProcessConfig{
+		Name:            "api",
+		Command:         "/bin/sh",
+		Args:            []string{"-c", `echo x >> "$OUT"; exec sleep 60`},
+		ENV:             map[string]string{"OUT": out},
+		CWD:             dir,
+		Stdout:          []string{"/dev/null"},
+		Watch:           []string{"./bin/api", "./bin/*.yaml"},
+		WatchIgnore:     []string{"*.swp"},
+		WatchDebounceMs: 200,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) { exits.Add(1) })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	starts := func() int {
+		data, _ := os.ReadFile(out)
+		return strings.Count(string(data), "x")
+	}
+
+	/* a binary written in chunks restarts process once */
+	f, _ := os.Create(filepath.Join(dir, "bin", "api"))
+	for i := 0; i < 5; i++ {
+		f.WriteString("chunk")
+		time.Sleep(50 * time.Millisecond)
+	}
+	f.Close()
+	time.Sleep(time.Second)
+	if n := starts(); n != 2 {
+		t.Fatalf("expect one restart, got %d starts", n)
+	}
+	if p.GetState().State != Running {
+		t.Fatalf("bad state %v", p.GetState().State)
+	}
+	if exits.Load() != 0 {
+		t.Fatal("restarted process should not be reported as done")
+	}
+
+	/* ignored and unmatched files change nothing */
+	os.WriteFile(filepath.Join(dir, "bin", ".api.swp"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "bin", "other"), []byte("x"), 0644)
+	time.Sleep(500 * time.Millisecond)
+	if n := starts(); n != 2 {
+		t.Fatalf("unexpected restart, got %d starts", n)
+	}
+
+	/* stopped process is not started by changes */
+	p.Stop(false)
+	os.WriteFile(filepath.Join(dir, "bin", "app.yaml"), []byte("x"), 0644)
+	time.Sleep(500 * time.Millisecond)
+	if n := starts(); n != 2 || p.GetState().State != Stopped {
+		t.Fatalf("stopped process restarted, got %d starts", n)
+	}
+}
+
+func TestWatchReloadSignal(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "reloads")
+	cnf := (&config.ProcessConfig{
+		Name:            "api",
+		Command:         "/bin/sh",
+		Args:            []string{"-c", `trap 'echo r >> "$OUT"' HUP; while true; do sleep 0.05; done`},
+		ENV:             map[string]string{"OUT": out},
+		CWD:             dir,
+		Stdout:          []string{"/dev/null"},
+		ReloadSignal:    "HUP",
+		Watch:           []string{"."},
+		WatchIgnore:     []string{"reloads"},
+		WatchDebounceMs: 100,
+	}).FillDefaults()
+	p := NewProcess(cnf, func(bool) {})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(true)
+	pid := p.GetState().PID
+	time.Sleep(100 * time.Millisecond)
+
+	os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("x"), 0644)
+	time.Sleep(600 * time.Millisecond)
+	if data, _ := os.ReadFile(out); string(data) != "r\n" {
+		t.Fatalf("expect one reload, got %q", data)
+	}
+	if p.GetState().PID != pid {
+		t.Fatal("process should be reloaded in place")
+	}
+}
@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	myhttp "github.com/qjpcpu/http"
+	"github.com/qjpcpu/supervisord/config"
+)
+
+const (
+	defaultWebhookRetries   = 3
+	defaultWebhookQueueSize = 100
+	defaultWebhookTimeout   = 10
+)
+
+var webhookRetryInterval = time.Second
+
+// WebhookPayload is the data rendered by notify template
+type WebhookPayload struct {
+	*Event
+	Hostname string
+}
+
+// webhookManager runs one notifier per [[notify]] block
+type webhookManager struct {
+	mu        sync.Mutex
+	notifiers []*webhookNotifier
+}
+
+func newWebhookManager() *webhookManager {
+	return &webhookManager{}
+}
+
+// Reload replaces all notifiers with new config, pending deliveries of old notifiers are finished in background
+func (m *webhookManager) Reload(list []*config.NotifyConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range m.notifiers {
+		n.Stop()
+	}
+	m.notifiers = nil
+	for _, c := range list {
+		n, err := newWebhookNotifier(c)
+		if err != nil {
+			logger.Log("[notify] create notifier %s fail %v", c.URL, err)
+			continue
+		}
+		m.notifiers = append(m.notifiers, n)
+	}
+}
+
+func (m *webhookManager) Stop() {
+	m.Reload(nil)
+}
+
+type webhookNotifier struct {
+	conf   *config.NotifyConfig
+	tpl    *template.Template
+	client myhttp.Client
+	cancel func()
+}
+
+func newWebhookNotifier(c *config.NotifyConfig) (*webhookNotifier, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("notify url is empty")
+	}
+	n := &webhookNotifier{
+		conf:   c,
+		client: myhttp.NewClient().SetTimeout(time.Duration(firstPositive(c.TimeoutSecs, defaultWebhookTimeout)) * time.Second),
+	}
+	if c.Template != "" {
+		tpl, err := template.New("notify").Funcs(template.FuncMap{
+			"json": func(v any) string {
+				bs, _ := json.Marshal(v)
+				return string(bs)
+			},
+		}).Parse(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		n.tpl = tpl
+	}
+	/* the subscription channel is the bounded delivery queue */
+	ch, cancel := events.Subscribe(EventFilter{Names: c.Process, Types: c.Events}, firstPositive(c.QueueSize, defaultWebhookQueueSize))
+	n.cancel = cancel
+	go func() {
+		for e := range ch {
+			n.deliver(e)
+		}
+	}()
+	return n, nil
+}
+
+func (n *webhookNotifier) Stop() {
+	n.cancel()
+}
+
+func (n *webhookNotifier) deliver(e *Event) {
+	body, err := n.render(e)
+	if err != nil {
+		logger.Log("[notify] render %s event of %s fail %v", e.Type, e.Name, err)
+		return
+	}
+	retries := firstPositive(n.conf.Retries, defaultWebhookRetries)
+	interval := webhookRetryInterval
+	for i := 0; ; i++ {
+		if err = n.post(body); err == nil {
+			return
+		}
+		if i >= retries {
+			break
+		}
+		time.Sleep(interval)
+		interval *= 2
+	}
+	logger.Log("[notify] send %s event of %s to %s fail %v", e.Type, e.Name, n.conf.URL, err)
+}
+
+func (n *webhookNotifier) render(e *Event) ([]byte, error) {
+	host, _ := os.Hostname()
+	payload := &WebhookPayload{Event: e, Hostname: host}
+	if n.tpl == nil {
+		return json.Marshal(payload)
+	}
+	buf := new(bytes.Buffer)
+	if err := n.tpl.Execute(buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *webhookNotifier) post(body []byte) error {
+	method := strings.ToUpper(n.conf.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range n.conf.Headers {
+		headers[k] = v
+	}
+	return n.client.Do(context.Background(), method, n.conf.URL, bytes.NewReader(body), myhttp.WithHeaders(headers)).
+		HandleResult(func(res *http.Response) error {
+			if res.StatusCode < 200 || res.StatusCode >= 300 {
+				data, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+				return fmt.Errorf("status %s %s", res.Status, strings.TrimSpace(string(data)))
+			}
+			io.Copy(io.Discard, res.Body)
+			return nil
+		})
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/supervisord/config"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	webhookRetryInterval = 10 * time.Millisecond
+	var mu sync.Mutex
+	var calls int
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		/* first attempt fails to exercise retry */
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+	}))
+	defer srv.Close()
+
+	m := newWebhookManager()
+	m.Reload([]*config.NotifyConfig{{
+		URL:      srv.URL,
+		Events:   []string{"FATAL", "EXITED"},
+		Process:  []string{"api"},
+		Template: `{"text":"{{.Name}} {{.Type}} code={{.ExitCode}}"}`,
+	}})
+	defer m.Stop()
+
+	events.Publish(&Event{Type: EventRunning, Name: "api"})
+	events.Publish(&Event{Type: EventExited, Name: "worker"})
+	events.Publish(&Event{Type: EventExited, Name: "api", ExitCode: 2})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(bodies)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	/* give filtered events a chance to show up if filter were broken */
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(bodies) != 1 || bodies[0] != `{"text":"api EXITED code=2"}` {
+		t.Fatalf("unexpected deliveries calls=%d bodies=%q", calls, bodies)
+	}
+}
@@ -0,0 +1,180 @@
+//go:build !windows
+// +build !windows
+
+package reaper
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// registry hands exit status reaped by reaper to the waiter of the child, so a running reaper never
+// steals exit status of commands started by supervisord itself
+var registry = struct {
+	sync.Mutex
+	stop, done chan struct{} /* reaper is running if not nil */
+	waiters    map[int]chan syscall.WaitStatus
+	commands   map[*exec.Cmd]chan syscall.WaitStatus
+	children   map[int]struct{} /* children waited by their waiter, never reaped by ReapOrphan */
+}{
+	waiters:  make(map[int]chan syscall.WaitStatus),
+	commands: make(map[*exec.Cmd]chan syscall.WaitStatus),
+	children: make(map[int]struct{}),
+}
+
+// ExitError is a failed exit of child reaped by reaper, its text is same as exec.ExitError
+type ExitError struct {
+	Status syscall.WaitStatus
+}
+
+func (e *ExitError) Error() string {
+	var text string
+	switch status := e.Status; {
+	case status.Exited():
+		text = "exit status " + strconv.Itoa(status.ExitStatus())
+	case status.Signaled():
+		text = "signal: " + status.Signal().String()
+	case status.Stopped():
+		text = "stop signal: " + status.StopSignal().String()
+	default:
+		text = "unknown status " + strconv.Itoa(int(status))
+	}
+	if e.Status.CoreDump() {
+		text += " (core dumped)"
+	}
+	return text
+}
+
+// ExitCode returns exit code of child, -1 if it is terminated by signal
+func (e *ExitError) ExitCode() int {
+	return exitCode(e.Status)
+}
+
+func exitCode(status syscall.WaitStatus) int {
+	if !status.Exited() {
+		return -1
+	}
+	return status.ExitStatus()
+}
+
+func exitResult(status syscall.WaitStatus) (int, error) {
+	if status.Exited() && status.ExitStatus() == 0 {
+		return 0, nil
+	}
+	return exitCode(status), &ExitError{Status: status}
+}
+
+// deliver hands exit status to waiter of pid, it reports whether pid has one
+func deliver(pid int, status syscall.WaitStatus) bool {
+	registry.Lock()
+	defer registry.Unlock()
+	ch, ok := registry.waiters[pid]
+	if ok {
+		delete(registry.waiters, pid)
+		ch <- status
+	}
+	return ok
+}
+
+// StartCommand starts cmd, its exit status is kept for WaitCommand while reaper is running.
+// Every command started by supervisord must use it with WaitCommand instead of cmd.Start and cmd.Wait
+func StartCommand(cmd *exec.Cmd) error {
+	/* held across fork so reaper never sees pid before it is registered */
+	registry.Lock()
+	defer registry.Unlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	registry.children[cmd.Process.Pid] = struct{}{}
+	if registry.stop != nil {
+		ch := make(chan syscall.WaitStatus, 1)
+		registry.waiters[cmd.Process.Pid] = ch
+		registry.commands[cmd] = ch
+	}
+	return nil
+}
+
+// WaitCommand waits cmd started by StartCommand like cmd.Wait and returns its exit code, -1 if cmd
+// is terminated by signal or can not be waited
+func WaitCommand(cmd *exec.Cmd) (int, error) {
+	if cmd.Process != nil {
+		defer forget(cmd.Process.Pid)
+	}
+	registry.Lock()
+	ch, ok := registry.commands[cmd]
+	delete(registry.commands, cmd)
+	registry.Unlock()
+	if ok {
+		if status, ok := <-ch; ok {
+			/* releases output copying of cmd, the child is reaped already */
+			cmd.Wait()
+			return exitResult(status)
+		}
+	}
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return -1, err
+	}
+	return cmd.ProcessState.ExitCode(), err
+}
+
+// WaitProcess waits child not started by StartCommand, e.g. one inherited by exec
+func WaitProcess(proc *os.Process) (int, error) {
+	defer forget(proc.Pid)
+	registry.Lock()
+	registry.children[proc.Pid] = struct{}{}
+	var ch chan syscall.WaitStatus
+	if registry.stop != nil {
+		ch = make(chan syscall.WaitStatus, 1)
+		registry.waiters[proc.Pid] = ch
+	}
+	registry.Unlock()
+	if ch != nil {
+		/* it may be reaped as zombie before registered */
+		if syscall.Kill(proc.Pid, 0) == syscall.ESRCH {
+			registry.Lock()
+			defer registry.Unlock()
+			select {
+			case status := <-ch:
+				return exitResult(status)
+			default:
+			}
+			delete(registry.waiters, proc.Pid)
+			return -1, errors.New("child is reaped already")
+		}
+		if status, ok := <-ch; ok {
+			return exitResult(status)
+		}
+	}
+	state, err := proc.Wait()
+	if err != nil {
+		return -1, err
+	}
+	if !state.Success() {
+		return state.ExitCode(), &exec.ExitError{ProcessState: state}
+	}
+	return 0, nil
+}
+
+func forget(pid int) {
+	registry.Lock()
+	delete(registry.children, pid)
+	registry.Unlock()
+}
+
+// ReapOrphan reaps zombie child pid which is not started by StartCommand nor waited by WaitProcess,
+// e.g. a descendant reparented to subreaper. It reports whether pid is reaped
+func ReapOrphan(pid int) bool {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.children[pid]; ok {
+		return false
+	}
+	var status syscall.WaitStatus
+	wpid, _ := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	return wpid == pid
+}
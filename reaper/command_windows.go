@@ -0,0 +1,35 @@
+// +build windows
+
+package reaper
+
+import (
+	"os"
+	"os/exec"
+)
+
+func StartCommand(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+func WaitCommand(cmd *exec.Cmd) (int, error) {
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return -1, err
+	}
+	return cmd.ProcessState.ExitCode(), err
+}
+
+func WaitProcess(proc *os.Process) (int, error) {
+	state, err := proc.Wait()
+	if err != nil {
+		return -1, err
+	}
+	if !state.Success() {
+		return state.ExitCode(), &exec.ExitError{ProcessState: state}
+	}
+	return 0, nil
+}
+
+func ReapOrphan(pid int) bool {
+	return false
+}
@@ -18,12 +18,18 @@ var debug bool = false
 
 //  Handle death of child (SIGCHLD) messages. Pushes the signal onto the
 //  notifications channel if there is a waiter.
-func sigChildHandler(notifications chan os.Signal) {
+func sigChildHandler(notifications chan os.Signal, stop chan struct{}) {
 	var sigs = make(chan os.Signal, 3)
 	signal.Notify(sigs, syscall.SIGCHLD)
+	defer signal.Stop(sigs)
 
 	for {
-		var sig = <-sigs
+		var sig os.Signal
+		select {
+		case sig = <-sigs:
+		case <-stop:
+			return
+		}
 		select {
 		case notifications <- sig: /*  published it.  */
 		default:
@@ -38,37 +44,45 @@ func sigChildHandler(notifications chan os.Signal) {
 
 } /*  End of function  sigChildHandler.  */
 
-//  Be a good parent - clean up behind the children.
-func reapChildren(config Config) {
+//  Be a good parent - clean up behind the children. Exit status of
+//  commands started by StartCommand is handed to their waiter, other
+//  children are reaped as zombies.
+func reapChildren(config Config, stop chan struct{}, done chan struct{}) {
+	defer close(done)
 	var notifications = make(chan os.Signal, 1)
 
-	go sigChildHandler(notifications)
+	go sigChildHandler(notifications, stop)
 
-	pid := config.Pid
-	opts := config.Options
+	/*  children may exit before SIGCHLD is handled  */
+	notifications <- syscall.SIGCHLD
 
 	for {
-		var sig = <-notifications
-		if debug {
-			fmt.Printf(" - Received signal %v\n", sig)
+		select {
+		case sig := <-notifications:
+			if debug {
+				fmt.Printf(" - Received signal %v\n", sig)
+			}
+		case <-stop:
+			return
 		}
 		for {
 			var wstatus syscall.WaitStatus
 
 			/*
 			 *  Reap 'em, so that zombies don't accumulate.
-			 *  Plants vs. Zombies!!
+			 *  Plants vs. Zombies!! Never block, so the reaper
+			 *  can be stopped.
 			 */
-			pid, err := syscall.Wait4(pid, &wstatus, opts, nil)
+			pid, err := syscall.Wait4(config.Pid, &wstatus, config.Options|syscall.WNOHANG, nil)
 			for syscall.EINTR == err {
-				pid, err = syscall.Wait4(pid, &wstatus, opts, nil)
+				pid, err = syscall.Wait4(config.Pid, &wstatus, config.Options|syscall.WNOHANG, nil)
 			}
 
-			if syscall.ECHILD == err {
+			if err != nil || pid <= 0 {
 				break
 			}
 
-			if debug {
+			if !deliver(pid, wstatus) && debug {
 
 				fmt.Printf(" - Grim reaper cleanup: pid=%d, wstatus=%+v\n",
 					pid, wstatus)
@@ -136,6 +150,33 @@ func Start(config Config) {
 	 *  of 'em all, either way we get to play the grim reaper.
 	 *  You will be missed, Terry Pratchett!! RIP
 	 */
-	go reapChildren(config)
+	Stop()
+	registry.Lock()
+	registry.stop = make(chan struct{})
+	registry.done = make(chan struct{})
+	go reapChildren(config, registry.stop, registry.done)
+	registry.Unlock()
 
 } /*  End of [exported] function  Start.  */
+
+//  Stop the reaper, commands still running are waited by their waiter
+//  directly.
+func Stop() {
+	registry.Lock()
+	stop, done := registry.stop, registry.done
+	registry.stop, registry.done = nil, nil
+	registry.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+
+	registry.Lock()
+	for pid, ch := range registry.waiters {
+		close(ch)
+		delete(registry.waiters, pid)
+	}
+	registry.Unlock()
+
+} /*  End of [exported] function  Stop.  */
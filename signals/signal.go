@@ -45,15 +45,16 @@ var signalMap = map[string]os.Signal{"SIGABRT": syscall.SIGABRT,
 	"SIGXCPU":   syscall.SIGXCPU,
 	"SIGXFSZ":   syscall.SIGXFSZ}
 
-// ToSignal returns OS dependent signal name for given signal name (or syscall.SIGTERM if garbage given)
+// ToSignal returns OS dependent signal for given signal name like TERM or SIGTERM, unknown name is an error
 func ToSignal(signalName string) (os.Signal, error) {
+	signalName = strings.ToUpper(strings.TrimSpace(signalName))
 	if !strings.HasPrefix(signalName, "SIG") {
 		signalName = fmt.Sprintf("SIG%s", signalName)
 	}
 	if sig, ok := signalMap[signalName]; ok {
 		return sig, nil
 	}
-	return syscall.SIGTERM, nil
+	return nil, fmt.Errorf("unknown signal %s", signalName)
 }
 
 // Kill sends signal to the process
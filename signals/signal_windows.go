@@ -24,9 +24,10 @@ func ToSignal(signalName string) (os.Signal, error) {
 		return nil, errors.New("signal USR1 is not supported in windows")
 	} else if signalName == "USR2" {
 		return nil, errors.New("signal USR2 is not supported in windows")
-	} else {
+	} else if signalName == "TERM" {
 		return syscall.SIGTERM, nil
-
+	} else {
+		return nil, fmt.Errorf("signal %s is not supported in windows", signalName)
 	}
 
 }